@@ -2,7 +2,6 @@ module github.com/jcbhmr/xmod
 
 go 1.24.1
 
-require (
-	github.com/psanford/memfs v0.0.0-20241019191636-4ef911798f9b // indirect
-	golang.org/x/mod v0.24.0 // indirect
-)
+require golang.org/x/mod v0.24.0
+
+require github.com/psanford/memfs v0.0.0-20241019191636-4ef911798f9b // indirect
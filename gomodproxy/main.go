@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"go/build"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/debug"
+	"syscall"
+	"time"
+
+	"github.com/jcbhmr/xmod/proxy"
+)
+
+var version = func() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		panic("could not read build info")
+	}
+	return bi.Main.Version
+}()
+
+func Usage() {
+	o := flag.CommandLine.Output()
+	o.Write([]byte(`gomodproxy ` + version + `
+Basic Go module proxy server
+
+usage: gomodproxy [-addr address] [-dir dir | -modcache | -upstream goproxy] [-sumdb] [-v]
+
+gomodproxy serves the GOPROXY protocol from a directory in GOPROXY file
+layout, from the local module cache, or from upstream proxies given as a
+GOPROXY list. With no backend flag, the local module cache is served.
+Requests to upstream proxies are authenticated according to GOAUTH, as
+with the go command. With -sumdb, the GOSUMDB checksum database is
+proxied too, so that clients can verify modules without reaching it
+directly.
+
+https://go.dev/ref/mod#goproxy-protocol
+
+example:
+gomodproxy
+gomodproxy -addr localhost:3000 -dir ./proxy
+gomodproxy -upstream 'https://goproxy.example.com|https://proxy.golang.org' -v
+gomodproxy -upstream https://proxy.golang.org -sumdb
+`))
+	flag.PrintDefaults()
+}
+
+func Help() {
+	flag.CommandLine.SetOutput(os.Stdout)
+	flag.Usage()
+	os.Exit(0)
+}
+
+var addr string
+var dir string
+var modcache bool
+var upstream string
+var sumdb bool
+var verbose bool
+
+func init() {
+	flag.StringVar(&addr, "addr", "localhost:8080", "listen address")
+	flag.StringVar(&dir, "dir", "", "serve a directory in GOPROXY file layout")
+	flag.BoolVar(&modcache, "modcache", false, "serve $GOMODCACHE/cache/download")
+	flag.StringVar(&upstream, "upstream", "", "serve an upstream GOPROXY list")
+	flag.BoolVar(&sumdb, "sumdb", false, "proxy the GOSUMDB checksum database")
+	flag.BoolVar(&verbose, "v", false, "log each request")
+	flag.Usage = Usage
+}
+
+func Parse() {
+	flag.Parse()
+	if flag.NArg() > 0 {
+		log.Println("too many arguments")
+		flag.Usage()
+		os.Exit(2)
+	}
+	n := 0
+	if dir != "" {
+		n++
+	}
+	if modcache {
+		n++
+	}
+	if upstream != "" {
+		n++
+	}
+	if n > 1 {
+		log.Println("only one of -dir, -modcache and -upstream may be set")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if n == 0 {
+		modcache = true
+	}
+}
+
+// goModCache returns the module cache directory the go command would use.
+func goModCache() string {
+	if v := os.Getenv("GOMODCACHE"); v != "" {
+		return v
+	}
+	list := filepath.SplitList(build.Default.GOPATH)
+	if len(list) == 0 || list[0] == "" {
+		return ""
+	}
+	return filepath.Join(list[0], "pkg", "mod")
+}
+
+func main() {
+	Parse()
+
+	var cfg *proxy.Config
+	if upstream != "" || sumdb {
+		var err error
+		cfg, err = proxy.LoadConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var ops proxy.ServerOps
+	switch {
+	case dir != "":
+		ops = &dirOps{fsys: os.DirFS(dir)}
+	case modcache:
+		root := goModCache()
+		if root == "" {
+			log.Fatal("cannot determine GOMODCACHE")
+		}
+		ops = &dirOps{fsys: os.DirFS(filepath.Join(root, "cache", "download"))}
+	case upstream != "":
+		httpOps, err := proxy.NewHTTPOps(upstream)
+		if err != nil {
+			log.Fatal(err)
+		}
+		httpOps.Auth, err = proxy.NewAuth(cfg.GOAUTH)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if verbose {
+			httpOps.Logger = log.Default()
+		}
+		client := proxy.NewClient(proxy.NewRetryOps(httpOps, nil))
+		if verbose {
+			client.SetLogger(slog.Default())
+		}
+		ops = &upstreamOps{client: client}
+	}
+
+	handler := proxy.NewServer(ops)
+	if verbose {
+		handler.SetLogger(slog.Default())
+	}
+	if sumdb {
+		db, err := cfg.NewSumDB()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if db == nil {
+			log.Fatal("-sumdb set, but GOSUMDB=off")
+		}
+		handler.SetSumDB(db)
+	}
+	srv := &http.Server{Addr: addr, Handler: handler}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	log.Print("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = <-errc
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/jcbhmr/xmod/proxy"
+	"golang.org/x/mod/module"
+)
+
+// dirOps serves a file system laid out like a GOPROXY=file:// directory,
+// which is also the layout of $GOMODCACHE/cache/download.
+type dirOps struct {
+	fsys fs.FS
+}
+
+func (d *dirOps) readFile(path, name string) ([]byte, error) {
+	epath, err := module.EscapePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(d.fsys, epath+"/"+name)
+}
+
+func (d *dirOps) versionFile(m module.Version, ext string) (string, error) {
+	epath, err := module.EscapePath(m.Path)
+	if err != nil {
+		return "", err
+	}
+	eversion, err := module.EscapeVersion(m.Version)
+	if err != nil {
+		return "", err
+	}
+	return epath + "/@v/" + eversion + ext, nil
+}
+
+func (d *dirOps) Versions(ctx context.Context, path string) ([]string, error) {
+	data, err := d.readFile(path, "@v/list")
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	versions := []string{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) > 0 {
+			versions = append(versions, string(line))
+		}
+	}
+	return versions, nil
+}
+
+func (d *dirOps) Stat(ctx context.Context, m module.Version) (*proxy.RevInfo, error) {
+	name, err := d.versionFile(m, ".info")
+	if err != nil {
+		return nil, err
+	}
+	data, err := fs.ReadFile(d.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var ri *proxy.RevInfo
+	err = json.Unmarshal(data, &ri)
+	if err != nil {
+		return nil, err
+	}
+	return ri, nil
+}
+
+func (d *dirOps) GoMod(ctx context.Context, m module.Version) ([]byte, error) {
+	name, err := d.versionFile(m, ".mod")
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(d.fsys, name)
+}
+
+func (d *dirOps) Zip(ctx context.Context, dst io.Writer, m module.Version) error {
+	name, err := d.versionFile(m, ".zip")
+	if err != nil {
+		return err
+	}
+	f, err := d.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+// ZipFile lets the server answer Range requests for zip files.
+func (d *dirOps) ZipFile(ctx context.Context, m module.Version) (io.ReadSeeker, time.Time, error) {
+	name, err := d.versionFile(m, ".zip")
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	f, err := d.fsys.Open(name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, err
+	}
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		f.Close()
+		return nil, time.Time{}, fmt.Errorf("%s: not seekable", name)
+	}
+	return rs, info.ModTime(), nil
+}
+
+// upstreamOps serves whatever an upstream proxy returns.
+type upstreamOps struct {
+	client *proxy.Client
+}
+
+func (u *upstreamOps) Versions(ctx context.Context, path string) ([]string, error) {
+	repo, err := u.client.Lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return repo.VersionsContext(ctx, "")
+}
+
+func (u *upstreamOps) Stat(ctx context.Context, m module.Version) (*proxy.RevInfo, error) {
+	repo, err := u.client.Lookup(m.Path)
+	if err != nil {
+		return nil, err
+	}
+	return repo.StatContext(ctx, m.Version)
+}
+
+func (u *upstreamOps) GoMod(ctx context.Context, m module.Version) ([]byte, error) {
+	repo, err := u.client.Lookup(m.Path)
+	if err != nil {
+		return nil, err
+	}
+	return repo.GoModContext(ctx, m.Version)
+}
+
+func (u *upstreamOps) Zip(ctx context.Context, dst io.Writer, m module.Version) error {
+	repo, err := u.client.Lookup(m.Path)
+	if err != nil {
+		return err
+	}
+	return repo.ZipContext(ctx, dst, m.Version)
+}
+
+func (u *upstreamOps) Latest(ctx context.Context, path string) (*proxy.RevInfo, error) {
+	repo, err := u.client.Lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return repo.LatestContext(ctx)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jcbhmr/xmod/proxy"
+)
+
+func TestDirOps_Latest(t *testing.T) {
+	// The module cache has no @latest files, only lists and .info files.
+	fsys := fstest.MapFS{
+		"example.org/!awesome/@v/list":        {Data: []byte("v1.0.0\nv1.1.0\n")},
+		"example.org/!awesome/@v/v1.0.0.info": {Data: []byte(`{"Version":"v1.0.0","Time":"2024-01-01T00:00:00Z"}`)},
+		"example.org/!awesome/@v/v1.1.0.info": {Data: []byte(`{"Version":"v1.1.0","Time":"2024-02-01T00:00:00Z"}`)},
+		"example.org/!awesome/@v/v1.1.0.mod":  {Data: []byte("module example.org/Awesome\n")},
+	}
+	server := httptest.NewServer(proxy.NewServer(&dirOps{fsys: fsys}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/example.org/!awesome/@latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+	var ri proxy.RevInfo
+	if err := json.NewDecoder(resp.Body).Decode(&ri); err != nil {
+		t.Fatal(err)
+	}
+	if ri.Version != "v1.1.0" || ri.Time.IsZero() {
+		t.Errorf("@latest = %+v, want v1.1.0 with its time", ri)
+	}
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"flag"
+	"io/fs"
 	"log"
 	"os"
 	"runtime/debug"
+
+	"github.com/jcbhmr/xmod/zip"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
 )
 
 var version = func() string {
@@ -20,16 +25,17 @@ func Usage() {
 	o.Write([]byte(`gomodzip ` + version + `
 Prototype 'go mod zip'
 
-usage: gomodzip [-o output] [path]
+usage: gomodzip -v version [-o output] [path]
 
-gomodzip creates a module zip file for the given path.
+gomodzip creates a module zip file for the given path. The module path is
+read from the go.mod file in that directory.
 
 https://go.dev/ref/mod#zip-files
 
 example:
-gomodzip
-gomodzip ./submodule
-gomodzip -o tools0.31.0.zip
+gomodzip -v v1.0.0
+gomodzip -v v1.0.0 ./submodule
+gomodzip -v v0.31.0 -o tools0.31.0.zip
 `))
 	flag.PrintDefaults()
 }
@@ -42,9 +48,11 @@ func Help() {
 
 var path string
 var output string
+var modVersion string
 
 func init() {
 	flag.StringVar(&output, "o", "", "output file name")
+	flag.StringVar(&modVersion, "v", "", "module version")
 	flag.Usage = Usage
 }
 
@@ -53,6 +61,11 @@ func Parse() {
 	if output == "" {
 		output = "gomod.zip"
 	}
+	if modVersion == "" {
+		log.Println("missing -v version")
+		flag.Usage()
+		os.Exit(2)
+	}
 	if flag.NArg() > 1 {
 		log.Println("too many arguments")
 		flag.Usage()
@@ -67,10 +80,41 @@ func Parse() {
 func main() {
 	Parse()
 
+	fsys := os.DirFS(path)
+	data, err := fs.ReadFile(fsys, "go.mod")
+	if err != nil {
+		log.Fatal(err)
+	}
+	modPath := modfile.ModulePath(data)
+	if modPath == "" {
+		log.Fatalf("%s: no module declaration in go.mod", path)
+	}
+	m := module.Version{Path: modPath, Version: modVersion}
+
+	cf, err := zip.CheckDirFS(fsys, ".")
+	for _, fe := range cf.Omitted {
+		log.Printf("omitted %s: %v", fe.Path, fe.Err)
+	}
+	for _, fe := range cf.Invalid {
+		log.Printf("invalid %s: %v", fe.Path, fe.Err)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	f, err := os.Create(output)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer f.Close()
 
+	err = zip.CreateFromFS(fsys, f, m, ".")
+	if err != nil {
+		f.Close()
+		os.Remove(output)
+		log.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,290 @@
+// Package gosum computes and checks go.sum files, fetching modules through
+// a proxy.Client instead of the go command's module cache.
+//
+// https://go.dev/ref/mod#go-sum-files
+package gosum
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jcbhmr/xmod/modgraph"
+	"github.com/jcbhmr/xmod/proxy"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// Sums holds the lines of a go.sum file, mapping each module version to
+// its hashes. The hashes of a go.mod file are keyed by a Version ending in
+// "/go.mod". A go.sum file may hold more than one hash for a module
+// version, such as hashes made with different algorithms; Compare checks
+// whether they agree.
+type Sums map[module.Version][]string
+
+// Parse parses the content of a go.sum file.
+func Parse(data []byte) (Sums, error) {
+	sums := Sums{}
+	for i, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) != 3 {
+			return nil, fmt.Errorf("go.sum:%d: wrong number of fields %v", i+1, len(f))
+		}
+		m := module.Version{Path: f[0], Version: f[1]}
+		if !slices.Contains(sums[m], f[2]) {
+			sums[m] = append(sums[m], f[2])
+		}
+	}
+	return sums, nil
+}
+
+// Format returns the content of a go.sum file holding s, sorted the way
+// the go command sorts it.
+func (s Sums) Format() []byte {
+	list := make([]module.Version, 0, len(s))
+	for m := range s {
+		list = append(list, m)
+	}
+	module.Sort(list)
+	var buf bytes.Buffer
+	for _, m := range list {
+		for _, h := range s[m] {
+			fmt.Fprintf(&buf, "%s %s %s\n", m.Path, m.Version, h)
+		}
+	}
+	return buf.Bytes()
+}
+
+// Compute returns the go.mod and zip hashes of every module in list. A
+// module whose Version is "", such as the main module of a build list, is
+// skipped.
+func Compute(ctx context.Context, client *proxy.Client, list []module.Version) (Sums, error) {
+	var jobs []job
+	for _, m := range list {
+		if m.Version == "" {
+			continue
+		}
+		jobs = append(jobs, job{m, m, true}, job{m, m, false})
+	}
+	return compute(ctx, client, jobs)
+}
+
+// ComputeGraph returns the hashes that the go.sum file of the main module
+// of g needs: the go.mod hash of every module in g whose requirements were
+// loaded or that is selected, and the zip hash of every selected module.
+// Replaced modules are hashed as their replacements, and directory
+// replacements are skipped, as in the go command.
+//
+// The go command only records the zip hashes of modules that provide
+// imported packages, so a tidy go.sum may lack some of the zip hashes
+// returned here.
+func ComputeGraph(ctx context.Context, client *proxy.Client, g *modgraph.Graph) (Sums, error) {
+	main := g.Main()
+	need := map[module.Version]bool{}
+	for _, m := range g.Modules() {
+		if _, ok := g.Required(m); ok || g.Selected(m.Path) == m.Version {
+			need[m] = true
+		}
+	}
+	var jobs []job
+	add := func(m module.Version, goMod bool) {
+		actual, ok := g.Replacement(m)
+		if !ok {
+			actual = m
+		}
+		if actual.Version == "" {
+			return
+		}
+		jobs = append(jobs, job{m, actual, goMod})
+	}
+	for m := range need {
+		add(m, true)
+	}
+	for _, m := range g.BuildList() {
+		if m != main {
+			add(m, false)
+		}
+	}
+	return compute(ctx, client, jobs)
+}
+
+// A job hashes the go.mod file or zip of actual, which is m or its
+// replacement.
+type job struct {
+	m, actual module.Version
+	goMod     bool
+}
+
+// compute runs jobs, many at a time, and returns the first error.
+func compute(ctx context.Context, client *proxy.Client, jobs []job) (Sums, error) {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, 16)
+		sums     = Sums{}
+	)
+	for _, j := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			key := j.actual
+			var h string
+			var err error
+			if j.goMod {
+				key.Version += "/go.mod"
+				h, err = hashGoMod(ctx, client, j.actual)
+			} else {
+				h, err = hashZip(ctx, client, j.actual)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s@%s: %w", j.m.Path, j.m.Version, err)
+				}
+				return
+			}
+			sums[key] = []string{h}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return sums, nil
+}
+
+func hashGoMod(ctx context.Context, client *proxy.Client, m module.Version) (string, error) {
+	repo, err := client.Lookup(m.Path)
+	if err != nil {
+		return "", err
+	}
+	data, err := repo.GoModContext(ctx, m.Version)
+	if err != nil {
+		return "", err
+	}
+	return dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+}
+
+func hashZip(ctx context.Context, client *proxy.Client, m module.Version) (string, error) {
+	repo, err := client.Lookup(m.Path)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp("", "modzip-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	err = repo.ZipContext(ctx, f, m.Version)
+	if err != nil {
+		return "", err
+	}
+	err = f.Close()
+	if err != nil {
+		return "", err
+	}
+	return dirhash.HashZip(f.Name(), dirhash.Hash1)
+}
+
+// A Mismatch is a module version whose go.sum hashes disagree with the
+// computed ones.
+type Mismatch struct {
+	Module     module.Version
+	Have, Want []string
+}
+
+// A Diff lists the differences between a go.sum file and the hashes it
+// should hold. Each list is sorted.
+type Diff struct {
+	Missing    []module.Version // computed, but not in go.sum
+	Extra      []module.Version // in go.sum, but not computed
+	Mismatched []Mismatch
+}
+
+// Compare compares the hashes in a go.sum file, have, with the computed
+// hashes, want. As in the go command, a module version matches if have
+// holds each of its wanted hashes and no other hash made with the same
+// algorithm, such as a second "h1:" hash.
+func Compare(have, want Sums) *Diff {
+	d := &Diff{}
+	for m, w := range want {
+		h, ok := have[m]
+		if !ok {
+			d.Missing = append(d.Missing, m)
+		} else if !hashesMatch(h, w) {
+			d.Mismatched = append(d.Mismatched, Mismatch{Module: m, Have: h, Want: w})
+		}
+	}
+	for m := range have {
+		if _, ok := want[m]; !ok {
+			d.Extra = append(d.Extra, m)
+		}
+	}
+	module.Sort(d.Missing)
+	module.Sort(d.Extra)
+	byModule := map[module.Version]Mismatch{}
+	var mismatched []module.Version
+	for _, mm := range d.Mismatched {
+		byModule[mm.Module] = mm
+		mismatched = append(mismatched, mm.Module)
+	}
+	module.Sort(mismatched)
+	for i, m := range mismatched {
+		d.Mismatched[i] = byModule[m]
+	}
+	return d
+}
+
+// hashesMatch reports whether the go.sum hashes have agree with the
+// computed hashes want.
+func hashesMatch(have, want []string) bool {
+	for _, w := range want {
+		if !slices.Contains(have, w) {
+			return false
+		}
+		alg, _, _ := strings.Cut(w, ":")
+		for _, h := range have {
+			if h != w && strings.HasPrefix(h, alg+":") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Empty reports whether there are no differences.
+func (d *Diff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Mismatched) == 0
+}
+
+// String formats the differences for display, one module version per
+// entry.
+func (d *Diff) String() string {
+	var buf strings.Builder
+	for _, m := range d.Missing {
+		fmt.Fprintf(&buf, "missing: %s %s\n", m.Path, m.Version)
+	}
+	for _, m := range d.Extra {
+		fmt.Fprintf(&buf, "extra: %s %s\n", m.Path, m.Version)
+	}
+	for _, mm := range d.Mismatched {
+		fmt.Fprintf(&buf, "mismatch: %s %s\n\tgo.sum: %s\n\tcomputed: %s\n", mm.Module.Path, mm.Module.Version, strings.Join(mm.Have, " "), strings.Join(mm.Want, " "))
+	}
+	return buf.String()
+}
@@ -0,0 +1,204 @@
+package gosum_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jcbhmr/xmod/gosum"
+	"github.com/jcbhmr/xmod/modgraph"
+	"github.com/jcbhmr/xmod/proxy"
+	xzip "github.com/jcbhmr/xmod/zip"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+	modzip "golang.org/x/mod/zip"
+)
+
+// mapClientOps serves remote paths from a map.
+type mapClientOps map[string][]byte
+
+func (m mapClientOps) ReadRemote(path string) ([]byte, error) {
+	data, ok := m[path]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return data, nil
+}
+
+func (m mapClientOps) Log(msg string) {}
+
+// addModule adds a module with the given go.mod file to ops and returns
+// its go.sum hashes, computed independently of the gosum package.
+func addModule(t *testing.T, ops mapClientOps, m module.Version, goMod string) gosum.Sums {
+	t.Helper()
+	zfiles, err := xzip.Files(fstest.MapFS{
+		"go.mod": {Data: []byte(goMod)},
+		"lib.go": {Data: []byte("package lib\n")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = modzip.Create(&buf, m, zfiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops["/"+m.Path+"/@v/"+m.Version+".mod"] = []byte(goMod)
+	ops["/"+m.Path+"/@v/"+m.Version+".zip"] = buf.Bytes()
+
+	name := filepath.Join(t.TempDir(), "mod.zip")
+	err = os.WriteFile(name, buf.Bytes(), 0o666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipHash, err := dirhash.HashZip(name, dirhash.Hash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modHash, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader([]byte(goMod))), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gosum.Sums{
+		m: {zipHash},
+		{Path: m.Path, Version: m.Version + "/go.mod"}: {modHash},
+	}
+}
+
+func TestCompute(t *testing.T) {
+	ops := mapClientOps{}
+	a := module.Version{Path: "example.org/a", Version: "v1.0.0"}
+	b := module.Version{Path: "example.org/b", Version: "v1.1.0"}
+	want := gosum.Sums{}
+	for m, h := range addModule(t, ops, a, "module example.org/a\n") {
+		want[m] = h
+	}
+	for m, h := range addModule(t, ops, b, "module example.org/b\n") {
+		want[m] = h
+	}
+	client := proxy.NewClient(ops)
+
+	got, err := gosum.Compute(context.Background(), client, []module.Version{{Path: "example.org/main"}, a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := gosum.Compare(got, want); !d.Empty() {
+		t.Fatalf("Compute differs from independently computed hashes:\n%s", d)
+	}
+
+	parsed, err := gosum.Parse(got.Format())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := gosum.Compare(parsed, want); !d.Empty() {
+		t.Fatalf("Parse(Format()) differs:\n%s", d)
+	}
+}
+
+func TestComputeGraph(t *testing.T) {
+	ops := mapClientOps{}
+	a := module.Version{Path: "example.org/a", Version: "v1.0.0"}
+	b := module.Version{Path: "example.org/b", Version: "v1.0.0"}
+	fork := module.Version{Path: "example.org/fork", Version: "v1.5.0"}
+	aSums := addModule(t, ops, a, "module example.org/a\n\ngo 1.17\n\nrequire example.org/b v1.0.0\n")
+	addModule(t, ops, b, "module example.org/b\n\ngo 1.17\n")
+	forkSums := addModule(t, ops, fork, "module example.org/b\n\ngo 1.17\n")
+	client := proxy.NewClient(ops)
+
+	gomod := "module example.org/main\n\ngo 1.21\n\nrequire (\n\texample.org/a v1.0.0\n\texample.org/b v1.0.0\n)\n\nreplace example.org/b => example.org/fork v1.5.0\n"
+	g, err := modgraph.Load(context.Background(), client, "go.mod", []byte(gomod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := gosum.ComputeGraph(context.Background(), client, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := gosum.Sums{}
+	for m, h := range aSums {
+		want[m] = h
+	}
+	for m, h := range forkSums {
+		want[m] = h
+	}
+	if d := gosum.Compare(got, want); !d.Empty() {
+		t.Fatalf("ComputeGraph differs:\n%s", d)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	have, err := gosum.Parse([]byte("example.org/a v1.0.0 h1:aaa=\nexample.org/a v1.0.0/go.mod h1:bbb=\n\nexample.org/old v1.0.0/go.mod h1:ccc=\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := gosum.Sums{
+		{Path: "example.org/a", Version: "v1.0.0"}:        {"h1:aaa="},
+		{Path: "example.org/a", Version: "v1.0.0/go.mod"}: {"h1:xxx="},
+		{Path: "example.org/b", Version: "v1.0.0"}:        {"h1:ddd="},
+	}
+	d := gosum.Compare(have, want)
+	if len(d.Missing) != 1 || d.Missing[0] != (module.Version{Path: "example.org/b", Version: "v1.0.0"}) {
+		t.Errorf("Missing = %v", d.Missing)
+	}
+	if len(d.Extra) != 1 || d.Extra[0] != (module.Version{Path: "example.org/old", Version: "v1.0.0/go.mod"}) {
+		t.Errorf("Extra = %v", d.Extra)
+	}
+	if len(d.Mismatched) != 1 || !reflect.DeepEqual(d.Mismatched[0], gosum.Mismatch{
+		Module: module.Version{Path: "example.org/a", Version: "v1.0.0/go.mod"},
+		Have:   []string{"h1:bbb="},
+		Want:   []string{"h1:xxx="},
+	}) {
+		t.Errorf("Mismatched = %v", d.Mismatched)
+	}
+	if d.Empty() {
+		t.Error("Empty() = true")
+	}
+}
+
+func TestParse_MultipleHashes(t *testing.T) {
+	data := "example.org/a v1.0.0 h1:aaa=\nexample.org/a v1.0.0 h2:bbb=\nexample.org/a v1.0.0 h1:aaa=\n"
+	have, err := gosum.Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := module.Version{Path: "example.org/a", Version: "v1.0.0"}
+	if h := have[m]; !reflect.DeepEqual(h, []string{"h1:aaa=", "h2:bbb="}) {
+		t.Fatalf("Parse: hashes = %q", h)
+	}
+	if got, want := string(have.Format()), "example.org/a v1.0.0 h1:aaa=\nexample.org/a v1.0.0 h2:bbb=\n"; got != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+
+	if d := gosum.Compare(have, gosum.Sums{m: {"h1:aaa="}}); !d.Empty() {
+		t.Errorf("Compare with a hash of another algorithm:\n%s", d)
+	}
+
+	conflicting, err := gosum.Parse([]byte("example.org/a v1.0.0 h1:aaa=\nexample.org/a v1.0.0 h1:ccc=\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := gosum.Compare(conflicting, gosum.Sums{m: {"h1:aaa="}})
+	if len(d.Mismatched) != 1 || !reflect.DeepEqual(d.Mismatched[0].Have, []string{"h1:aaa=", "h1:ccc="}) {
+		t.Errorf("Compare with conflicting hashes: Mismatched = %v", d.Mismatched)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, data := range []string{
+		"example.org/a v1.0.0\n",
+		"example.org/a v1.0.0 h1:aaa= extra\n",
+	} {
+		_, err := gosum.Parse([]byte(data))
+		if err == nil {
+			t.Errorf("Parse(%q): expected error", data)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// Package modgraph computes module requirement graphs and minimal version
+// selection build lists from go.mod files fetched through a proxy.Client.
+//
+// https://go.dev/ref/mod#minimal-version-selection
+package modgraph
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"go/version"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/jcbhmr/xmod/proxy"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// A Graph is the module requirement graph of a main module.
+type Graph struct {
+	main     module.Version
+	requires map[module.Version][]module.Version
+	selected map[string]string
+	replace  map[module.Version]module.Version
+}
+
+// Main returns the main module, whose Version is "".
+func (g *Graph) Main() module.Version {
+	return g.main
+}
+
+// Required returns the requirements of m, after replacements and
+// exclusions, and whether they were loaded. Requirements of modules whose
+// go.mod files were pruned out of the graph are not loaded.
+func (g *Graph) Required(m module.Version) ([]module.Version, bool) {
+	reqs, ok := g.requires[m]
+	return slices.Clone(reqs), ok
+}
+
+// Modules returns every module version in the graph, sorted by path and
+// version, including versions that lose to higher ones in selection.
+func (g *Graph) Modules() []module.Version {
+	seen := map[module.Version]bool{}
+	for m, reqs := range g.requires {
+		seen[m] = true
+		for _, r := range reqs {
+			seen[r] = true
+		}
+	}
+	delete(seen, g.main)
+	var list []module.Version
+	for m := range seen {
+		list = append(list, m)
+	}
+	module.Sort(list)
+	return list
+}
+
+// Replacement returns the module that replaces m according to the main
+// module's replace directives, and whether there is one. A directory
+// replacement has an empty Version.
+func (g *Graph) Replacement(m module.Version) (module.Version, bool) {
+	if r, ok := g.replace[m]; ok {
+		return r, true
+	}
+	r, ok := g.replace[module.Version{Path: m.Path}]
+	return r, ok
+}
+
+// Selected returns the version selected for the module path, or "none".
+func (g *Graph) Selected(path string) string {
+	if path == g.main.Path {
+		return ""
+	}
+	v, ok := g.selected[path]
+	if !ok {
+		return "none"
+	}
+	return v
+}
+
+// BuildList returns the main module followed by the selected version of
+// every other module path in the graph, sorted by path, as 'go list -m
+// all' prints them.
+func (g *Graph) BuildList() []module.Version {
+	list := []module.Version{g.main}
+	for path, v := range g.selected {
+		if path != g.main.Path {
+			list = append(list, module.Version{Path: path, Version: v})
+		}
+	}
+	slices.SortFunc(list[1:], func(a, b module.Version) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+	return list
+}
+
+// Load loads the requirement graph of the main module whose go.mod file
+// is data, read from the file named gomod. It fetches the go.mod files of
+// dependencies through client, many at a time.
+//
+// The main module's replace and exclude directives apply throughout the
+// graph. Directory replacements are read from disk, relative to the
+// directory of gomod. If the main module is at go 1.17 or higher, the
+// graph is pruned the way the go command prunes it: the requirements of
+// dependencies that are also at go 1.17 or higher are included, but not
+// followed further.
+//
+// https://go.dev/ref/mod#graph-pruning
+func Load(ctx context.Context, client *proxy.Client, gomod string, data []byte) (*Graph, error) {
+	f, err := modfile.Parse(gomod, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.Module == nil {
+		return nil, fmt.Errorf("%s: no module declaration", gomod)
+	}
+
+	l := &loader{
+		ctx:      ctx,
+		client:   client,
+		dir:      filepath.Dir(gomod),
+		main:     module.Version{Path: f.Module.Mod.Path},
+		replace:  map[module.Version]module.Version{},
+		exclude:  map[module.Version]bool{},
+		sem:      make(chan struct{}, 16),
+		requires: map[module.Version][]module.Version{},
+		selected: map[string]string{},
+		loading:  map[module.Version]bool{},
+		unpruned: map[module.Version]bool{},
+	}
+	for _, r := range f.Replace {
+		l.replace[r.Old] = r.New
+	}
+	for _, x := range f.Exclude {
+		l.exclude[x.Mod] = true
+	}
+
+	var reqs []module.Version
+	for _, r := range f.Require {
+		reqs = append(reqs, r.Mod)
+	}
+	reqs = l.filter(reqs)
+	l.require(l.main, reqs)
+
+	pruning := isPruned(f)
+	for _, r := range reqs {
+		l.enqueue(r, pruning)
+	}
+	l.wg.Wait()
+
+	if l.err != nil {
+		return nil, l.err
+	}
+	return &Graph{main: l.main, requires: l.requires, selected: l.selected, replace: l.replace}, nil
+}
+
+type loader struct {
+	ctx     context.Context
+	client  *proxy.Client
+	dir     string
+	main    module.Version
+	replace map[module.Version]module.Version
+	exclude map[module.Version]bool
+	sem     chan struct{}
+	wg      sync.WaitGroup
+
+	mu       sync.Mutex
+	requires map[module.Version][]module.Version
+	selected map[string]string
+	loading  map[module.Version]bool
+	unpruned map[module.Version]bool
+	err      error
+}
+
+// enqueue starts loading the requirements of m, if that has not started
+// already. This mirrors readModGraph in cmd/go/internal/modload.
+func (l *loader) enqueue(m module.Version, pruned bool) {
+	if m.Version == "none" || m.Path == l.main.Path {
+		return
+	}
+	l.mu.Lock()
+	if l.loading[m] && (pruned || l.unpruned[m]) {
+		// Already loading, and the graph may contain cycles.
+		l.mu.Unlock()
+		return
+	}
+	l.loading[m] = true
+	if !pruned {
+		l.unpruned[m] = true
+	}
+	l.mu.Unlock()
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		l.sem <- struct{}{}
+		f, err := l.goMod(m)
+		<-l.sem
+		if err != nil {
+			l.fail(fmt.Errorf("%s@%s: %w", m.Path, m.Version, err))
+			return
+		}
+
+		var reqs []module.Version
+		for _, r := range f.Require {
+			reqs = append(reqs, r.Mod)
+		}
+		reqs = l.filter(reqs)
+		l.require(m, reqs)
+
+		// If m does not support pruning, its explicit requirements may not
+		// be enough to build it, so its full transitive graph is needed.
+		nextPruned := isPruned(f) && pruned
+		for _, r := range reqs {
+			if !pruned || !isPruned(f) {
+				l.enqueue(r, nextPruned)
+			}
+		}
+	}()
+}
+
+// goMod reads the go.mod file of m, or of its replacement.
+func (l *loader) goMod(m module.Version) (*modfile.File, error) {
+	actual, ok := l.replace[m]
+	if !ok {
+		actual, ok = l.replace[module.Version{Path: m.Path}]
+	}
+	if !ok {
+		actual = m
+	}
+
+	var data []byte
+	var name string
+	if actual.Version == "" {
+		dir := actual.Path
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(l.dir, dir)
+		}
+		name = filepath.Join(dir, "go.mod")
+		var err error
+		data, err = os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		name = actual.Path + "@" + actual.Version + "/go.mod"
+		repo, err := l.client.Lookup(actual.Path)
+		if err != nil {
+			return nil, err
+		}
+		data, err = repo.GoModContext(l.ctx, actual.Version)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return modfile.ParseLax(name, data, nil)
+}
+
+// filter drops requirements on excluded versions, as the go command has
+// done since Go 1.16.
+func (l *loader) filter(reqs []module.Version) []module.Version {
+	var out []module.Version
+	for _, r := range reqs {
+		if !l.exclude[r] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// require records the requirements of m and updates the selected
+// versions.
+func (l *loader) require(m module.Version, reqs []module.Version) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requires[m] = reqs
+	for _, r := range reqs {
+		if r.Path == l.main.Path || r.Version == "none" {
+			continue
+		}
+		if v, ok := l.selected[r.Path]; !ok || semver.Compare(r.Version, v) > 0 {
+			l.selected[r.Path] = r.Version
+		}
+	}
+}
+
+func (l *loader) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err == nil {
+		l.err = err
+	}
+}
+
+// isPruned reports whether f is at go 1.17 or higher, and so lists every
+// module that provides a package its own packages import.
+func isPruned(f *modfile.File) bool {
+	if f.Go == nil {
+		return false
+	}
+	return version.Compare("go"+f.Go.Version, "go1.17") >= 0
+}
@@ -0,0 +1,158 @@
+package modgraph_test
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jcbhmr/xmod/modgraph"
+	"github.com/jcbhmr/xmod/proxy"
+	"golang.org/x/mod/module"
+)
+
+type goModServerOps map[module.Version]string
+
+func (g goModServerOps) Versions(ctx context.Context, path string) ([]string, error) {
+	return nil, fs.ErrNotExist
+}
+
+func (g goModServerOps) Stat(ctx context.Context, m module.Version) (*proxy.RevInfo, error) {
+	return nil, fs.ErrNotExist
+}
+
+func (g goModServerOps) GoMod(ctx context.Context, m module.Version) ([]byte, error) {
+	data, ok := g[m]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return []byte(data), nil
+}
+
+func (g goModServerOps) Zip(ctx context.Context, dst io.Writer, m module.Version) error {
+	return fs.ErrNotExist
+}
+
+func newClient(t *testing.T) *proxy.Client {
+	server := httptest.NewServer(proxy.NewServer(goModServerOps{
+		{Path: "example.org/a", Version: "v1.0.0"}:    "module example.org/a\n\ngo 1.17\n\nrequire example.org/b v1.1.0\n",
+		{Path: "example.org/b", Version: "v1.0.0"}:    "module example.org/b\n\ngo 1.17\n",
+		{Path: "example.org/b", Version: "v1.1.0"}:    "module example.org/b\n\ngo 1.17\n\nrequire example.org/c v1.2.0\n",
+		{Path: "example.org/b", Version: "v1.3.0"}:    "module example.org/b\n\ngo 1.17\n",
+		{Path: "example.org/c", Version: "v1.2.0"}:    "module example.org/c\n\ngo 1.17\n",
+		{Path: "example.org/d", Version: "v1.0.0"}:    "module example.org/d\n\ngo 1.16\n\nrequire example.org/e v1.0.0\n",
+		{Path: "example.org/e", Version: "v1.0.0"}:    "module example.org/e\n\ngo 1.17\n\nrequire example.org/f v1.0.0\n",
+		{Path: "example.org/f", Version: "v1.0.0"}:    "module example.org/f\n\ngo 1.17\n",
+		{Path: "example.org/fork", Version: "v1.5.0"}: "module example.org/fork\n\ngo 1.17\n\nrequire example.org/b v1.3.0\n",
+	}))
+	t.Cleanup(server.Close)
+	ops, err := proxy.NewHTTPOps(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proxy.NewClient(ops)
+}
+
+func TestLoad(t *testing.T) {
+	localDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(localDir, "go.mod"), []byte("module example.org/d\n\ngo 1.21\n\nrequire example.org/b v1.3.0\n"), 0o666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		gomod string
+		want  []string
+	}{
+		{
+			name:  "unpruned",
+			gomod: "module example.org/main\n\ngo 1.16\n\nrequire (\n\texample.org/a v1.0.0\n\texample.org/b v1.0.0\n)\n",
+			want:  []string{"example.org/main", "example.org/a v1.0.0", "example.org/b v1.1.0", "example.org/c v1.2.0"},
+		},
+		{
+			name:  "pruned",
+			gomod: "module example.org/main\n\ngo 1.21\n\nrequire example.org/a v1.0.0\n",
+			want:  []string{"example.org/main", "example.org/a v1.0.0", "example.org/b v1.1.0"},
+		},
+		{
+			name:  "pruned through unpruned dependency",
+			gomod: "module example.org/main\n\ngo 1.21\n\nrequire example.org/d v1.0.0\n",
+			want:  []string{"example.org/main", "example.org/d v1.0.0", "example.org/e v1.0.0", "example.org/f v1.0.0"},
+		},
+		{
+			name:  "exclude",
+			gomod: "module example.org/main\n\ngo 1.16\n\nrequire (\n\texample.org/a v1.0.0\n\texample.org/b v1.0.0\n)\n\nexclude example.org/b v1.1.0\n",
+			want:  []string{"example.org/main", "example.org/a v1.0.0", "example.org/b v1.0.0"},
+		},
+		{
+			name:  "replace version",
+			gomod: "module example.org/main\n\ngo 1.21\n\nrequire example.org/a v1.0.0\n\nreplace example.org/a v1.0.0 => example.org/fork v1.5.0\n",
+			want:  []string{"example.org/main", "example.org/a v1.0.0", "example.org/b v1.3.0"},
+		},
+		{
+			name:  "replace directory",
+			gomod: "module example.org/main\n\ngo 1.21\n\nrequire example.org/d v1.0.0\n\nreplace example.org/d => " + filepath.ToSlash(localDir) + "\n",
+			want:  []string{"example.org/main", "example.org/b v1.3.0", "example.org/d v1.0.0"},
+		},
+	}
+	client := newClient(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := modgraph.Load(context.Background(), client, filepath.Join(t.TempDir(), "go.mod"), []byte(tt.gomod))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range g.BuildList() {
+				if m.Version == "" {
+					got = append(got, m.Path)
+				} else {
+					got = append(got, m.Path+" "+m.Version)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("expected build list\n\t%v\ngot\n\t%v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGraph(t *testing.T) {
+	gomod := "module example.org/main\n\ngo 1.16\n\nrequire (\n\texample.org/a v1.0.0\n\texample.org/b v1.0.0\n)\n"
+	g, err := modgraph.Load(context.Background(), newClient(t), "go.mod", []byte(gomod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs, ok := g.Required(module.Version{Path: "example.org/a", Version: "v1.0.0"})
+	if !ok || !slices.Equal(reqs, []module.Version{{Path: "example.org/b", Version: "v1.1.0"}}) {
+		t.Fatalf("unexpected requirements of example.org/a: %v", reqs)
+	}
+	if v := g.Selected("example.org/b"); v != "v1.1.0" {
+		t.Fatalf("expected example.org/b v1.1.0 selected, got %s", v)
+	}
+	if v := g.Selected("example.org/missing"); v != "none" {
+		t.Fatalf("expected none, got %s", v)
+	}
+	want := []module.Version{
+		{Path: "example.org/a", Version: "v1.0.0"},
+		{Path: "example.org/b", Version: "v1.0.0"},
+		{Path: "example.org/b", Version: "v1.1.0"},
+		{Path: "example.org/c", Version: "v1.2.0"},
+	}
+	if got := g.Modules(); !slices.Equal(got, want) {
+		t.Fatalf("expected modules %v, got %v", want, got)
+	}
+}
+
+func TestLoad_Missing(t *testing.T) {
+	gomod := "module example.org/main\n\ngo 1.21\n\nrequire example.org/nowhere v1.0.0\n"
+	_, err := modgraph.Load(context.Background(), newClient(t), "go.mod", []byte(gomod))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
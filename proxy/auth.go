@@ -0,0 +1,424 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// DefaultGOAUTH is the GOAUTH value used when none is set.
+const DefaultGOAUTH = "netrc"
+
+// Auth adds credentials to HTTPS requests the way the go command does for
+// GOAUTH, a semicolon-separated list of:
+//
+//   - "off", which turns authentication off;
+//   - "netrc", which reads credentials from $NETRC or ~/.netrc;
+//   - "git dir", which runs 'git credential fill' in the absolute
+//     directory dir;
+//   - any other space-separated command, whose output lists URL prefixes
+//     and the headers to send to them.
+//
+// Credentials are matched against a request URL by path prefix, longest
+// first. All commands but "git" run before the first request. If a server
+// responds with a 4xx status, every command runs again with the URL as
+// an extra argument, and a custom command also gets the response status
+// line and headers on its standard input; the request is retried if that
+// yields credentials.
+//
+// Unlike the go command, Auth does not run 'git credential approve' or
+// 'git credential reject' afterwards.
+//
+// https://pkg.go.dev/cmd/go#hdr-GOAUTH_environment_variable
+type Auth struct {
+	cmds [][]string
+
+	once  sync.Once
+	mu    sync.Mutex
+	creds map[string]http.Header
+	errs  []error
+}
+
+// NewAuth returns an Auth for the given GOAUTH list. An empty list means
+// DefaultGOAUTH.
+func NewAuth(goauth string) (*Auth, error) {
+	if goauth == "" {
+		goauth = DefaultGOAUTH
+	}
+	a := &Auth{creds: map[string]http.Header{}}
+	if strings.TrimSpace(goauth) == "off" {
+		return a, nil
+	}
+	for _, cmd := range strings.Split(goauth, ";") {
+		words := strings.Fields(cmd)
+		if len(words) == 0 {
+			continue
+		}
+		switch words[0] {
+		case "off":
+			return nil, fmt.Errorf("GOAUTH=off cannot be combined with other authentication commands (GOAUTH=%s)", goauth)
+		case "netrc":
+			if len(words) != 1 {
+				return nil, fmt.Errorf("GOAUTH=netrc takes no arguments")
+			}
+		case "git":
+			if len(words) != 2 {
+				return nil, fmt.Errorf("GOAUTH=git dir method requires an absolute path to the git working directory")
+			}
+			if !filepath.IsAbs(words[1]) {
+				return nil, fmt.Errorf("GOAUTH=git dir method requires an absolute path to the git working directory, dir is not absolute")
+			}
+		}
+		a.cmds = append(a.cmds, words)
+	}
+	return a, nil
+}
+
+// Err returns the errors from the GOAUTH commands run so far, joined.
+func (a *Auth) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return errors.Join(a.errs...)
+}
+
+// addCredentials adds the credentials for req.URL to req, running the
+// GOAUTH commands first if they have not run yet. If resp is not nil, it
+// is a 4xx response to an earlier request for the same URL, and the
+// commands run again for it. addCredentials reports whether it found
+// credentials.
+func (a *Auth) addCredentials(ctx context.Context, req *http.Request, resp *http.Response) bool {
+	if req.URL.Scheme != "https" {
+		return false
+	}
+	a.once.Do(func() {
+		a.run(ctx, "", nil)
+	})
+	if resp != nil {
+		a.run(ctx, req.URL.String(), resp)
+	}
+	return a.load(req)
+}
+
+// run runs the GOAUTH commands, for the given URL and response if they
+// are not empty.
+func (a *Auth) run(ctx context.Context, u string, resp *http.Response) {
+	for _, words := range a.cmds {
+		var creds map[string]http.Header
+		var err error
+		switch words[0] {
+		case "netrc":
+			creds, err = netrcCredentials()
+		case "git":
+			if u == "" {
+				// 'git credential fill' needs a URL.
+				continue
+			}
+			creds, err = gitCredentials(ctx, words[1], u)
+		default:
+			creds, err = commandCredentials(ctx, words, u, resp)
+		}
+		a.mu.Lock()
+		if err != nil {
+			a.errs = append(a.errs, err)
+		}
+		for prefix, h := range creds {
+			a.store(prefix, h)
+		}
+		a.mu.Unlock()
+	}
+}
+
+// store records the header for a URL prefix. a.mu must be held.
+func (a *Auth) store(prefix string, h http.Header) {
+	prefix = strings.TrimSuffix(strings.TrimPrefix(prefix, "https://"), "/")
+	if len(h) == 0 {
+		delete(a.creds, prefix)
+	} else {
+		a.creds[prefix] = h
+	}
+}
+
+// load adds the header for the longest prefix of the URL of req to req.
+func (a *Auth) load(req *http.Request) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	prefix := strings.TrimPrefix(req.URL.String(), "https://")
+	for prefix != "/" && prefix != "." && prefix != "" {
+		h, ok := a.creds[prefix]
+		if !ok {
+			prefix = path.Dir(prefix)
+			continue
+		}
+		for k, vs := range h {
+			for _, v := range vs {
+				req.Header.Add(k, v)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// matchHeader returns the header of the longest key of headers that is a
+// prefix of u ending at a path element boundary, or nil.
+func matchHeader(headers map[string]http.Header, u string) http.Header {
+	var best string
+	var match http.Header
+	for prefix, h := range headers {
+		if !strings.HasPrefix(u, prefix) || len(prefix) < len(best) {
+			continue
+		}
+		if len(u) > len(prefix) && !strings.HasSuffix(prefix, "/") && u[len(prefix)] != '/' {
+			continue
+		}
+		best, match = prefix, h
+	}
+	return match
+}
+
+// netrcCredentials returns Basic authorization headers for the machines
+// in the .netrc file. A missing file yields none.
+func netrcCredentials() (map[string]http.Header, error) {
+	name, err := netrcPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	creds := map[string]http.Header{}
+	for _, l := range parseNetrc(string(data)) {
+		r := http.Request{Header: http.Header{}}
+		r.SetBasicAuth(l.login, l.password)
+		creds[l.machine] = r.Header
+	}
+	return creds, nil
+}
+
+// netrcPath mirrors netrcPath in cmd/go/internal/auth.
+func netrcPath() (string, error) {
+	if env := os.Getenv("NETRC"); env != "" {
+		return env, nil
+	}
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	// Prioritize _netrc on Windows for compatibility.
+	if runtime.GOOS == "windows" {
+		legacyPath := filepath.Join(dir, "_netrc")
+		_, err := os.Stat(legacyPath)
+		if err == nil {
+			return legacyPath, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, ".netrc"), nil
+}
+
+type netrcLine struct {
+	machine  string
+	login    string
+	password string
+}
+
+// parseNetrc mirrors parseNetrc in cmd/go/internal/auth.
+func parseNetrc(data string) []netrcLine {
+	// See https://www.gnu.org/software/inetutils/manual/html_node/The-_002enetrc-file.html
+	// for documentation on the .netrc format.
+	var nrc []netrcLine
+	var l netrcLine
+	inMacro := false
+	for _, line := range strings.Split(data, "\n") {
+		if inMacro {
+			if line == "" {
+				inMacro = false
+			}
+			continue
+		}
+
+		f := strings.Fields(line)
+		i := 0
+		for ; i < len(f)-1; i += 2 {
+			// Reset at each "machine" token.
+			// “The auto-login process searches the .netrc file for a machine token
+			// that matches […]. Once a match is made, the subsequent .netrc tokens
+			// are processed, stopping when the end of file is reached or another
+			// machine or a default token is encountered.”
+			switch f[i] {
+			case "machine":
+				l = netrcLine{machine: f[i+1]}
+			case "default":
+				break
+			case "login":
+				l.login = f[i+1]
+			case "password":
+				l.password = f[i+1]
+			case "macdef":
+				// “A macro is defined with the specified name; its contents begin with
+				// the next .netrc line and continue until a null line (consecutive
+				// new-line characters) is encountered.”
+				inMacro = true
+			}
+			if l.machine != "" && l.login != "" && l.password != "" {
+				nrc = append(nrc, l)
+				l = netrcLine{}
+			}
+		}
+
+		if i < len(f) && f[i] == "default" {
+			// “There can be only one default token, and it must be after all machine tokens.”
+			break
+		}
+	}
+	return nrc
+}
+
+// gitCredentials runs 'git credential fill' in dir for the URL u.
+func gitCredentials(ctx context.Context, dir, u string) (map[string]http.Header, error) {
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("url=%s\n", u))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("GOAUTH=git: 'git credential fill' failed: %v\n%s", err, out)
+	}
+	prefix, username, password := parseGitAuth(out)
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("GOAUTH=git: no credentials for %s", u)
+	}
+	if prefix == "" {
+		prefix = u
+	}
+	r := http.Request{Header: http.Header{}}
+	r.SetBasicAuth(username, password)
+	return map[string]http.Header{prefix: r.Header}, nil
+}
+
+// parseGitAuth mirrors parseGitAuth in cmd/go/internal/auth.
+func parseGitAuth(data []byte) (parsedPrefix, username, password string) {
+	prefix := new(url.URL)
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "protocol":
+			prefix.Scheme = value
+		case "host":
+			prefix.Host = value
+		case "path":
+			prefix.Path = value
+		case "username":
+			username = value
+		case "password":
+			password = value
+		case "url":
+			// Write to a local variable instead of updating prefix directly:
+			// if the url field is malformed, we don't want to invalidate
+			// information parsed from the protocol, host, and path fields.
+			u, err := url.ParseRequestURI(value)
+			if err == nil {
+				prefix = u
+			}
+		}
+	}
+	return prefix.String(), username, password
+}
+
+// commandCredentials runs a custom GOAUTH command, passing u as an extra
+// argument and resp on standard input if they are not empty.
+func commandCredentials(ctx context.Context, words []string, u string, resp *http.Response) (map[string]http.Header, error) {
+	args := words[1:]
+	if u != "" {
+		args = append(args[:len(args):len(args)], u)
+	}
+	cmd := exec.CommandContext(ctx, words[0], args...)
+	if resp != nil {
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "%s %s\n", resp.Proto, resp.Status)
+		resp.Header.Write(&buf)
+		buf.WriteString("\n")
+		cmd.Stdin = &buf
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("GOAUTH=%s: %v\n%s", strings.Join(words, " "), err, stderr.Bytes())
+	}
+	creds, err := parseUserAuth(bytes.NewReader(out))
+	if err != nil {
+		return nil, fmt.Errorf("GOAUTH=%s: %v", strings.Join(words, " "), err)
+	}
+	return creds, nil
+}
+
+// parseUserAuth mirrors parseUserAuth in cmd/go/internal/auth. The output
+// of a GOAUTH command is a series of blocks, each one or more "https://"
+// URL prefixes and a blank line, then headers and another blank line.
+func parseUserAuth(r io.Reader) (map[string]http.Header, error) {
+	creds := map[string]http.Header{}
+	reader := textproto.NewReader(bufio.NewReader(r))
+	for {
+		// Return the processed credentials if the reader is at EOF.
+		if _, err := reader.R.Peek(1); err == io.EOF {
+			return creds, nil
+		}
+		urls, err := readURLs(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(urls) == 0 {
+			return nil, fmt.Errorf("invalid format: expected url prefix")
+		}
+		mimeHeader, err := reader.ReadMIMEHeader()
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range urls {
+			creds[u] = http.Header(mimeHeader).Clone()
+		}
+	}
+}
+
+// readURLs reads URL prefixes up to a blank line.
+func readURLs(reader *textproto.Reader) ([]string, error) {
+	var urls []string
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(line) != line {
+			return nil, fmt.Errorf("invalid format: leading or trailing white space")
+		}
+		if strings.HasPrefix(line, "https://") {
+			urls = append(urls, line)
+		} else if line == "" {
+			return urls, nil
+		} else {
+			return nil, fmt.Errorf("invalid format: expected url prefix or newline")
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package proxy_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/jcbhmr/xmod/proxy"
+)
+
+// authServer starts an HTTPS proxy that serves a version list only to
+// requests with the given Authorization header.
+func authServer(t *testing.T, authorization string) *httptest.Server {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != authorization {
+			w.Header().Set("WWW-Authenticate", `Basic realm="proxy"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("v1.0.0\n"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// basicAuth is the Authorization header for alice:secret.
+const basicAuth = "Basic YWxpY2U6c2VjcmV0"
+
+func newAuthHTTPOps(t *testing.T, server *httptest.Server, goauth string) *proxy.HTTPOps {
+	t.Helper()
+	ops, err := proxy.NewHTTPOps(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops.Client = server.Client()
+	ops.Auth, err = proxy.NewAuth(goauth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ops
+}
+
+func readList(t *testing.T, ops *proxy.HTTPOps) error {
+	t.Helper()
+	data, err := ops.ReadRemote("/example.org/private/@v/list")
+	if err == nil && string(data) != "v1.0.0\n" {
+		t.Fatalf("unexpected data %q", data)
+	}
+	return err
+}
+
+func TestHTTPOps_Netrc(t *testing.T) {
+	server := authServer(t, basicAuth)
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	err = os.WriteFile(netrc, []byte("machine other.example login bob password hunter2\nmachine "+u.Host+"\n\tlogin alice\n\tpassword secret\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NETRC", netrc)
+
+	err = readList(t, newAuthHTTPOps(t, server, "netrc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = readList(t, newAuthHTTPOps(t, server, "off"))
+	var pe *proxy.Error
+	if !errors.As(err, &pe) || pe.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("GOAUTH=off: expected 401 *proxy.Error, got %v", err)
+	}
+}
+
+func TestHTTPOps_Header(t *testing.T) {
+	server := authServer(t, "Bearer token")
+	ops, err := proxy.NewHTTPOps(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops.Client = server.Client()
+	ops.Header = map[string]http.Header{
+		server.URL + "/example.org/private": {"Authorization": {"Bearer token"}},
+		server.URL + "/example.org/priv":    {"Authorization": {"Bearer wrong"}},
+		server.URL + "/":                    {"Authorization": {"Bearer wrong"}},
+	}
+	err = readList(t, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHTTPOps_GOAUTHCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	server := authServer(t, basicAuth)
+
+	// The command only gives credentials once it is told which URL failed
+	// and with what status, so the first request fails and is retried.
+	script := filepath.Join(t.TempDir(), "auth.sh")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+[ $# -eq 1 ] || exit 0
+case "$1" in
+`+server.URL+`/*) ;;
+*) exit 1 ;;
+esac
+read status
+case "$status" in
+*401*) ;;
+*) exit 1 ;;
+esac
+printf '%s/example.org/\n\nAuthorization: `+basicAuth+`\n\n' '`+server.URL+`'
+`), 0o777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := newAuthHTTPOps(t, server, "netrc; "+script)
+	t.Setenv("NETRC", filepath.Join(t.TempDir(), "missing"))
+	err = readList(t, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ops.Auth.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewAuth_Invalid(t *testing.T) {
+	for _, goauth := range []string{"off;netrc", "netrc extra", "git", "git relative/dir"} {
+		_, err := proxy.NewAuth(goauth)
+		if err == nil {
+			t.Errorf("NewAuth(%q): expected error", goauth)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// CacheOps is a ClientOps that caches the responses of another ClientOps
+// on disk, in the layout of $GOMODCACHE/cache/download:
+//
+//	<escaped path>/@v/<escaped version>.info
+//	<escaped path>/@v/<escaped version>.mod
+//	<escaped path>/@v/<escaped version>.zip
+//	<escaped path>/@v/<escaped version>.ziphash
+//	<escaped path>/@remote/list
+//	<escaped path>/@remote/latest
+//
+// The .info, .mod and .zip files of canonical versions never change, so
+// they are served from disk once present. A .zip only counts as present
+// once its .ziphash is written, as with the go command. The list and
+// @latest responses are fetched again once they are older than the TTL
+// given to NewCacheOps. They are kept under @remote, which the go command
+// never touches, rather than in @v/list: the go command rewrites @v/list
+// with only the versions it has downloaded, and the directory must not
+// list versions it has no files for when served as a GOPROXY.
+//
+// Files are written to a temporary name and renamed into place, so
+// several processes, including the go command, can share a directory.
+type CacheOps struct {
+	ops ClientOps
+	dir string
+	ttl time.Duration
+}
+
+// NewCacheOps returns a CacheOps that caches the responses of ops in dir,
+// revalidating list and @latest responses after ttl.
+func NewCacheOps(ops ClientOps, dir string, ttl time.Duration) *CacheOps {
+	return &CacheOps{ops: ops, dir: dir, ttl: ttl}
+}
+
+// cacheKind describes how a remote path may be cached.
+type cacheKind int
+
+const (
+	cacheNone cacheKind = iota
+	cacheMutable
+	cacheImmutable
+	cacheZip
+)
+
+func (c *CacheOps) kind(p string) cacheKind {
+	epath, rest, ok := strings.Cut(strings.TrimPrefix(p, "/"), "/@")
+	if !ok {
+		return cacheNone
+	}
+	if _, err := module.UnescapePath(epath); err != nil {
+		return cacheNone
+	}
+	if rest == "v/list" || rest == "latest" {
+		return cacheMutable
+	}
+	file, ok := strings.CutPrefix(rest, "v/")
+	if !ok {
+		return cacheNone
+	}
+	ext := path.Ext(file)
+	version, err := module.UnescapeVersion(strings.TrimSuffix(file, ext))
+	if err != nil || module.CanonicalVersion(version) != version {
+		// Queries like "master.info" can resolve differently over time.
+		return cacheNone
+	}
+	switch ext {
+	case ".info", ".mod":
+		return cacheImmutable
+	case ".zip":
+		return cacheZip
+	}
+	return cacheNone
+}
+
+// file returns the name of the cache file of the remote path p.
+func (c *CacheOps) file(p string) string {
+	p = strings.TrimPrefix(p, "/")
+	if epath, rest, ok := strings.Cut(p, "/@"); ok && (rest == "v/list" || rest == "latest") {
+		p = epath + "/@remote/" + path.Base(rest)
+	}
+	return filepath.Join(c.dir, filepath.FromSlash(p))
+}
+
+func (c *CacheOps) ReadRemote(path string) ([]byte, error) {
+	return c.ReadRemoteContext(context.Background(), path)
+}
+
+func (c *CacheOps) ReadRemoteContext(ctx context.Context, path string) ([]byte, error) {
+	kind := c.kind(path)
+	if kind == cacheZip {
+		rc, err := c.OpenRemote(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	if kind == cacheNone {
+		return readRemote(ctx, c.ops, path)
+	}
+
+	name := c.file(path)
+	if info, err := os.Stat(name); err == nil && (kind == cacheImmutable || time.Since(info.ModTime()) < c.ttl) {
+		data, err := os.ReadFile(name)
+		if err == nil {
+			noteCache(ctx, true)
+			return data, nil
+		}
+	}
+	noteCache(ctx, false)
+	data, err := readRemote(ctx, c.ops, path)
+	if err != nil {
+		return nil, err
+	}
+	err = writeFileAtomic(name, bytes.NewReader(data))
+	if err != nil {
+		c.ops.Log("writing cache: " + err.Error())
+	}
+	return data, nil
+}
+
+func (c *CacheOps) OpenRemote(ctx context.Context, path string) (io.ReadCloser, error) {
+	if c.kind(path) != cacheZip {
+		data, err := c.ReadRemoteContext(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	name := c.file(path)
+	ziphash := strings.TrimSuffix(name, ".zip") + ".ziphash"
+	if _, err := os.Stat(ziphash); err == nil {
+		f, err := os.Open(name)
+		if err == nil {
+			noteCache(ctx, true)
+			return f, nil
+		}
+	}
+	noteCache(ctx, false)
+
+	var src io.ReadCloser
+	if ops, ok := c.ops.(ClientOpsOpenRemote); ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		rc, err := ops.OpenRemote(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		src = rc
+	} else {
+		data, err := readRemote(ctx, c.ops, path)
+		if err != nil {
+			return nil, err
+		}
+		src = io.NopCloser(bytes.NewReader(data))
+	}
+	defer src.Close()
+	err := writeFileAtomic(name, &ctxReader{ctx, src})
+	if err != nil {
+		return nil, err
+	}
+	h, err := dirhash.HashZip(name, dirhash.Hash1)
+	if err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+	err = writeFileAtomic(ziphash, strings.NewReader(h))
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(name)
+}
+
+func (c *CacheOps) Log(msg string) {
+	c.ops.Log(msg)
+}
+
+// writeFileAtomic writes the content of r to name by way of a temporary
+// file in the same directory, so readers never see a partial file.
+func writeFileAtomic(name string, r io.Reader) (err error) {
+	dir := filepath.Dir(name)
+	err = os.MkdirAll(dir, 0o777)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	_, err = io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+	err = f.Chmod(0o644)
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
@@ -0,0 +1,186 @@
+package proxy_test
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jcbhmr/xmod/proxy"
+	"golang.org/x/mod/module"
+)
+
+type countingClientOps struct {
+	files map[string][]byte
+
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func (c *countingClientOps) ReadRemote(p string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reads == nil {
+		c.reads = map[string]int{}
+	}
+	c.reads[p]++
+	data, ok := c.files[p]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return data, nil
+}
+
+func (c *countingClientOps) Log(msg string) {}
+
+func TestCacheOps(t *testing.T) {
+	m := module.Version{Path: "example.org/Awesome", Version: "v1.0.0"}
+	zipData := makeModuleZip(t, m, fstest.MapFS{
+		"go.mod": {Data: []byte("module example.org/Awesome\n")},
+	})
+	upstream := &countingClientOps{files: map[string][]byte{
+		"/example.org/!awesome/@v/list":        []byte("v1.0.0\n"),
+		"/example.org/!awesome/@v/v1.0.0.info": []byte(`{"Version":"v1.0.0"}`),
+		"/example.org/!awesome/@v/v1.0.0.mod":  []byte("module example.org/Awesome\n"),
+		"/example.org/!awesome/@v/v1.0.0.zip":  zipData,
+		"/example.org/!awesome/@v/master.info": []byte(`{"Version":"v1.0.0"}`),
+	}}
+	dir := t.TempDir()
+
+	for _, ttl := range []time.Duration{time.Hour, 0} {
+		repo, err := proxy.NewClient(proxy.NewCacheOps(upstream, dir, ttl)).Lookup(m.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 2 {
+			_, err = repo.Versions("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = repo.Stat("v1.0.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = repo.Stat("master")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = repo.GoMod("v1.0.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			buffer := &bytes.Buffer{}
+			err = repo.Zip(buffer, "v1.0.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buffer.Bytes(), zipData) {
+				t.Fatal("cached zip differs from upstream")
+			}
+		}
+	}
+
+	want := map[string]int{
+		// Fetched once with the long TTL, then twice with no TTL.
+		"/example.org/!awesome/@v/list": 3,
+		// Immutable.
+		"/example.org/!awesome/@v/v1.0.0.info": 1,
+		"/example.org/!awesome/@v/v1.0.0.mod":  1,
+		"/example.org/!awesome/@v/v1.0.0.zip":  1,
+		// Not a canonical version, so never cached.
+		"/example.org/!awesome/@v/master.info": 4,
+	}
+	for p, n := range want {
+		if upstream.reads[p] != n {
+			t.Errorf("%s: expected %d upstream reads, got %d", p, n, upstream.reads[p])
+		}
+	}
+
+	for _, name := range []string{"@v/v1.0.0.info", "@v/v1.0.0.mod", "@v/v1.0.0.zip", "@v/v1.0.0.ziphash", "@remote/list"} {
+		_, err := os.Stat(filepath.Join(dir, "example.org", "!awesome", filepath.FromSlash(name)))
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	_, err := os.Stat(filepath.Join(dir, "example.org", "!awesome", "@v", "master.info"))
+	if err == nil {
+		t.Error("master.info was cached")
+	}
+	ziphash, err := os.ReadFile(filepath.Join(dir, "example.org", "!awesome", "@v", "v1.0.0.ziphash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHash := bytes.Fields(goSumLines(t, m, nil, zipData))[2]
+	if !bytes.Equal(ziphash, wantHash) {
+		t.Errorf("expected ziphash %s, got %s", wantHash, ziphash)
+	}
+}
+
+func TestCacheOps_GoCommandList(t *testing.T) {
+	upstream := &countingClientOps{files: map[string][]byte{
+		"/example.org/a/@v/list":        []byte("v1.0.0\nv1.1.0\n"),
+		"/example.org/a/@latest":        []byte(`{"Version":"v1.1.0"}`),
+		"/example.org/a/@v/v1.0.0.info": []byte(`{"Version":"v1.0.0"}`),
+	}}
+	dir := t.TempDir()
+	repo, err := proxy.NewClient(proxy.NewCacheOps(upstream, dir, time.Hour)).Lookup("example.org/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listFile := filepath.Join(dir, "example.org", "a", "@v", "list")
+
+	// The go command has downloaded v1.0.0 alone, and lists only it.
+	err = os.MkdirAll(filepath.Dir(listFile), 0o777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(listFile, []byte("v1.0.0\n"), 0o666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		versions, err := repo.Versions("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(versions) != 2 {
+			t.Errorf("Versions = %v, want the upstream list", versions)
+		}
+		_, err = repo.Stat("v1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := repo.Latest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Version != "v1.1.0" {
+			t.Errorf("Latest = %s, want v1.1.0", info.Version)
+		}
+
+		// The go command rewrites its list after each download.
+		err = os.WriteFile(listFile, []byte("v1.0.0\n"), 0o666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := upstream.reads["/example.org/a/@v/list"]; n != 1 {
+		t.Errorf("expected 1 upstream list read, got %d", n)
+	}
+
+	data, err := os.ReadFile(listFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "v1.0.0\n" {
+		t.Errorf("@v/list = %q, overwritten with versions not on disk", data)
+	}
+	_, err = os.Stat(filepath.Join(dir, "example.org", "a", "@latest"))
+	if err == nil {
+		t.Error("@latest was written into the module cache layout")
+	}
+}
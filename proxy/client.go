@@ -2,11 +2,14 @@ package proxy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"io/fs"
+	"log/slog"
 	"strings"
+	"sync"
 	"sync/atomic"
 
 	"golang.org/x/mod/module"
@@ -18,7 +21,12 @@ var ErrGONOPROXY = errors.New("skipped (listed in GONOPROXY)")
 type Client struct {
 	ops       ClientOps
 	didLookup atomic.Bool
-	gonoproxy string
+	cfg       Config
+	sumdb     atomic.Pointer[SumDB]
+	logger    atomic.Pointer[slog.Logger]
+	tracer    atomic.Pointer[Tracer]
+
+	excludeRetracted atomic.Bool
 }
 
 type ClientOps interface {
@@ -26,22 +34,87 @@ type ClientOps interface {
 	Log(msg string)
 }
 
+// ClientOpsContext is implemented by ClientOps that can honor a
+// context's deadline and cancellation. The Repo ...Context methods
+// prefer ReadRemoteContext over ReadRemote when it is available.
+type ClientOpsContext interface {
+	ClientOps
+	ReadRemoteContext(ctx context.Context, path string) ([]byte, error)
+}
+
+// ClientOpsOpenRemote is implemented by ClientOps that can stream the
+// content at a remote path instead of reading it all into memory.
+// Repo.ZipContext prefers OpenRemote over ReadRemote when it is available,
+// and the caller closes the returned reader.
+type ClientOpsOpenRemote interface {
+	ClientOps
+	OpenRemote(ctx context.Context, path string) (io.ReadCloser, error)
+}
+
 func NewClient(ops ClientOps) *Client {
 	return &Client{ops: ops}
 }
 
+// NewClientConfig returns a Client that routes lookups according to cfg,
+// as loaded by LoadConfig. Later changes to cfg do not affect the Client.
+func NewClientConfig(ops ClientOps, cfg *Config) *Client {
+	return &Client{ops: ops, cfg: *cfg}
+}
+
+// SetGONOPROXY sets the GONOPROXY list of a Client made by NewClient.
+//
+// Deprecated: Use NewClientConfig, which also handles GOPRIVATE and the
+// other module environment variables.
 func (c *Client) SetGONOPROXY(list string) {
 	if c.didLookup.Load() {
 		panic("SetGONOPROXY used after lookup")
 	}
-	if c.gonoproxy != "" {
+	if c.cfg.GONOPROXY != "" {
 		panic("multiple calls to SetGONOPROXY")
 	}
-	c.gonoproxy = list
+	c.cfg.GONOPROXY = list
+}
+
+// SetSumDB makes the Client verify go.mod files and zips against db,
+// except for modules that c.Config().NoSumDB reports. A nil db turns
+// verification off. Mismatches are reported as *ChecksumMismatchError.
+func (c *Client) SetSumDB(db *SumDB) {
+	c.sumdb.Store(db)
+}
+
+// SetExcludeRetracted makes Repo.Versions, Repo.Latest and Repo.Query
+// leave out versions retracted by the module author, the way the go
+// command does when it resolves @latest. See Repo.Retractions.
+func (c *Client) SetExcludeRetracted(exclude bool) {
+	c.excludeRetracted.Store(exclude)
+}
+
+// SetLogger makes the Client log each remote read of its Repos to logger:
+// a "proxy fetch start" record at level Debug, then a "proxy fetch" record
+// with the module, version, endpoint, upstream, bytes, duration, cache
+// hit or miss, retries and error, as far as they are known. A nil logger
+// turns logging off.
+func (c *Client) SetLogger(logger *slog.Logger) {
+	c.logger.Store(logger)
+}
+
+// SetTracer makes the Client start a span with tracer around each remote
+// read of its Repos. A nil tracer turns tracing off.
+func (c *Client) SetTracer(tracer Tracer) {
+	if tracer == nil {
+		c.tracer.Store(nil)
+		return
+	}
+	c.tracer.Store(&tracer)
+}
+
+// Config returns the Config that the Client routes lookups with.
+func (c *Client) Config() Config {
+	return c.cfg
 }
 
 func (c *Client) skip(target string) bool {
-	return module.MatchPrefixPatterns(c.gonoproxy, target)
+	return c.cfg.NoProxy(target)
 }
 
 func (c *Client) Lookup(path string) (*Repo, error) {
@@ -53,30 +126,117 @@ func (c *Client) Lookup(path string) (*Repo, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Repo{c.ops, path}, nil
+	return &Repo{c: c, ops: c.ops, path: path}, nil
 }
 
 type Repo struct {
+	c    *Client
 	ops  ClientOps
 	path string
+
+	retractMu   sync.Mutex
+	retractions []Retraction
+	retractDone bool
+}
+
+// sumdb returns the SumDB to verify r against, or nil.
+func (r *Repo) sumdb() *SumDB {
+	db := r.c.sumdb.Load()
+	if db == nil || r.c.cfg.NoSumDB(r.path) {
+		return nil
+	}
+	return db
+}
+
+func (r *Repo) readRemote(ctx context.Context, path string) ([]byte, error) {
+	ctx, ev := r.c.startFetch(ctx, path)
+	data, err := readRemote(ctx, r.ops, path)
+	err = withRemotePath(err, path)
+	finishFetch(ctx, ev, int64(len(data)), err)
+	return data, err
+}
+
+// withRemotePath fills in the Op, Module and Version of an *Error from
+// ClientOps that leave them out. The *Error may be wrapped, and is not
+// modified, as ClientOps may return the same one more than once.
+func withRemotePath(err error, path string) error {
+	var pe *Error
+	if !errors.As(err, &pe) || pe.Module != "" {
+		return err
+	}
+	e := *pe
+	e.Op, e.Module, e.Version = parseRemotePath(path)
+	if err == error(pe) {
+		return &e
+	}
+	return &remotePathError{err: err, pe: &e}
+}
+
+// remotePathError is a wrapped *Error whose filled-in copy pe is found
+// before the original by errors.As.
+type remotePathError struct {
+	err error
+	pe  *Error
+}
+
+func (e *remotePathError) Error() string {
+	return e.err.Error()
+}
+
+func (e *remotePathError) Unwrap() []error {
+	return []error{e.pe, e.err}
+}
+
+// readRemote calls ops.ReadRemoteContext if ops has it, or ops.ReadRemote
+// if ctx is not yet done.
+func readRemote(ctx context.Context, ops ClientOps, path string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ops, ok := ops.(ClientOpsContext); ok {
+		return ops.ReadRemoteContext(ctx, path)
+	}
+	return ops.ReadRemote(path)
 }
 
 func (r *Repo) Versions(prefix string) ([]string, error) {
+	return r.VersionsContext(context.Background(), prefix)
+}
+
+func (r *Repo) VersionsContext(ctx context.Context, prefix string) ([]string, error) {
+	versions, err := r.versions(ctx, prefix)
+	if err != nil || !r.c.excludeRetracted.Load() {
+		return versions, err
+	}
+	retractions, err := r.RetractionsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	allowed := versions[:0]
+	for _, v := range versions {
+		if !isRetracted(retractions, v) {
+			allowed = append(allowed, v)
+		}
+	}
+	return allowed, nil
+}
+
+// versions lists versions without leaving out retracted ones.
+func (r *Repo) versions(ctx context.Context, prefix string) ([]string, error) {
 	epath, err := module.EscapePath(r.path)
 	if err != nil {
 		return nil, err
 	}
-	data, err := r.ops.ReadRemote("/" + epath + "/@v/list")
+	data, err := r.readRemote(ctx, "/"+epath+"/@v/list")
 	if err != nil {
 		return nil, err
 	}
 	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
-	if data[len(data)-1] == '\n' {
-		data = data[:len(data)-1]
-	}
-	lines := bytes.Split(data, []byte("\n"))
 	versions := []string{}
-	for _, line := range lines {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
 		version := string(line)
 		err = module.Check(r.path, version)
 		if err != nil {
@@ -90,31 +250,43 @@ func (r *Repo) Versions(prefix string) ([]string, error) {
 }
 
 func (r *Repo) Latest() (*RevInfo, error) {
+	return r.LatestContext(context.Background())
+}
+
+func (r *Repo) LatestContext(ctx context.Context) (*RevInfo, error) {
+	ri, err := r.latest(ctx)
+	if err != nil || !r.c.excludeRetracted.Load() {
+		return ri, err
+	}
+	retractions, err := r.RetractionsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !isRetracted(retractions, ri.Version) {
+		return ri, nil
+	}
+	return r.QueryContext(ctx, "latest", "")
+}
+
+// latest is the proxy's @latest, or failing that the highest canonical
+// release, or prerelease if there is no release, without regard to
+// retractions.
+func (r *Repo) latest(ctx context.Context) (*RevInfo, error) {
 	epath, err := module.EscapePath(r.path)
 	if err != nil {
 		return nil, err
 	}
-	data, err := r.ops.ReadRemote("/" + epath + "/@latest")
+	data, err := r.readRemote(ctx, "/"+epath+"/@latest")
 	if errors.Is(err, fs.ErrNotExist) {
-		versions, err := r.Versions("")
+		versions, err := r.versions(ctx, "")
 		if err != nil {
 			return nil, err
 		}
-		if len(versions) == 0 {
-			return nil, errors.New("no versions found")
-		}
-		canonicalVersions := []string{}
-		for _, v := range versions {
-			if module.CanonicalVersion(v) == v {
-				canonicalVersions = append(canonicalVersions, v)
-			}
-		}
-		if len(canonicalVersions) == 0 {
-			return nil, errors.New("no canonical versions found")
+		latest, err := latestVersion(versions)
+		if err != nil {
+			return nil, err
 		}
-		semver.Sort(canonicalVersions)
-		latest := canonicalVersions[len(canonicalVersions)-1]
-		return r.Stat(latest)
+		return r.StatContext(ctx, latest)
 	} else if err != nil {
 		return nil, err
 	}
@@ -130,6 +302,10 @@ func (r *Repo) Latest() (*RevInfo, error) {
 }
 
 func (r *Repo) Stat(version string) (*RevInfo, error) {
+	return r.StatContext(context.Background(), version)
+}
+
+func (r *Repo) StatContext(ctx context.Context, version string) (*RevInfo, error) {
 	epath, err := module.EscapePath(r.path)
 	if err != nil {
 		return nil, err
@@ -138,7 +314,7 @@ func (r *Repo) Stat(version string) (*RevInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	data, err := r.ops.ReadRemote("/" + epath + "/@v/" + eversion + ".info")
+	data, err := r.readRemote(ctx, "/"+epath+"/@v/"+eversion+".info")
 	if err != nil {
 		return nil, err
 	}
@@ -154,6 +330,10 @@ func (r *Repo) Stat(version string) (*RevInfo, error) {
 }
 
 func (r *Repo) GoMod(version string) ([]byte, error) {
+	return r.GoModContext(context.Background(), version)
+}
+
+func (r *Repo) GoModContext(ctx context.Context, version string) ([]byte, error) {
 	epath, err := module.EscapePath(r.path)
 	if err != nil {
 		return nil, err
@@ -162,10 +342,24 @@ func (r *Repo) GoMod(version string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return r.ops.ReadRemote("/" + epath + "/@v/" + eversion + ".mod")
+	data, err := r.readRemote(ctx, "/"+epath+"/@v/"+eversion+".mod")
+	if err != nil {
+		return nil, err
+	}
+	if db := r.sumdb(); db != nil {
+		err = db.CheckGoModContext(ctx, r.path, version, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
 }
 
 func (r *Repo) Zip(dst io.Writer, version string) error {
+	return r.ZipContext(context.Background(), dst, version)
+}
+
+func (r *Repo) ZipContext(ctx context.Context, dst io.Writer, version string) error {
 	epath, err := module.EscapePath(r.path)
 	if err != nil {
 		return err
@@ -174,21 +368,52 @@ func (r *Repo) Zip(dst io.Writer, version string) error {
 	if err != nil {
 		return err
 	}
-	if fsys, ok := r.ops.(fs.FS); ok {
-		f, err := fsys.Open("/" + epath + "/@v/" + eversion + ".zip")
+	p := "/" + epath + "/@v/" + eversion + ".zip"
+	ctx, ev := r.c.startFetch(ctx, p)
+	sw := &sizeWriter{W: dst}
+	err = r.zip(ctx, sw, version, p)
+	finishFetch(ctx, ev, sw.Size, err)
+	return err
+}
+
+func (r *Repo) zip(ctx context.Context, dst io.Writer, version, p string) error {
+	var err error
+	db := r.sumdb()
+	var rc io.ReadCloser
+	if ops, ok := r.ops.(ClientOpsOpenRemote); ok {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rc, err = ops.OpenRemote(ctx, p)
 		if err != nil {
+			return withRemotePath(err, p)
+		}
+	} else if fsys, ok := r.ops.(fs.FS); ok {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-		defer f.Close()
-		_, err = io.Copy(dst, f)
+		rc, err = fsys.Open(p[1:])
+		if err != nil {
+			return err
+		}
+	}
+	if rc != nil {
+		defer rc.Close()
+		if db != nil {
+			return verifyZip(ctx, db, dst, r.path, version, rc)
+		}
+		_, err = io.Copy(dst, &ctxReader{ctx, rc})
 		if err != nil {
 			return err
 		}
 		return nil
 	} else {
-		data, err := r.ops.ReadRemote("/" + epath + "/@v/" + eversion + ".zip")
+		data, err := readRemote(ctx, r.ops, p)
 		if err != nil {
-			return err
+			return withRemotePath(err, p)
+		}
+		if db != nil {
+			return verifyZip(ctx, db, dst, r.path, version, bytes.NewReader(data))
 		}
 		n, err := dst.Write(data)
 		if err != nil {
@@ -200,3 +425,45 @@ func (r *Repo) Zip(dst io.Writer, version string) error {
 		return nil
 	}
 }
+
+// ctxReader stops reading from R once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	R   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.R.Read(p)
+}
+
+// latestVersion returns the highest canonical release in versions, or
+// the highest canonical prerelease if there is no release, for modules
+// whose proxy has no @latest. This is what Repo.Query picks for "latest".
+func latestVersion(versions []string) (string, error) {
+	if len(versions) == 0 {
+		return "", notExistError("no versions found")
+	}
+	var releases, prereleases []string
+	for _, v := range versions {
+		if module.CanonicalVersion(v) != v {
+			continue
+		}
+		if semver.Prerelease(v) != "" {
+			prereleases = append(prereleases, v)
+		} else {
+			releases = append(releases, v)
+		}
+	}
+	list := releases
+	if len(list) == 0 {
+		list = prereleases
+	}
+	if len(list) == 0 {
+		return "", notExistError("no canonical versions found")
+	}
+	semver.Sort(list)
+	return list[len(list)-1], nil
+}
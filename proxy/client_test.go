@@ -3,40 +3,27 @@ package proxy_test
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
-	"net/http"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/jcbhmr/xmod/proxy"
 	"golang.org/x/mod/modfile"
 )
 
-type HTTPClientOps struct {
-	BaseURL string
-}
-
-func (h *HTTPClientOps) ReadRemote(p string) ([]byte, error) {
-	resp, err := http.Get(h.BaseURL + p)
+func ExampleClient() {
+	ops, err := proxy.NewHTTPOps("https://proxy.golang.org")
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%s %d", resp.Request.URL, resp.StatusCode)
+		log.Fatal(err)
 	}
-	return io.ReadAll(resp.Body)
-}
-
-func (h *HTTPClientOps) Log(msg string) {
-	log.Print(msg)
-}
-
-func ExampleClient() {
-	client := proxy.NewClient(&HTTPClientOps{
-		BaseURL: "https://proxy.golang.org",
-	})
+	client := proxy.NewClient(ops)
 
 	modulePath := "golang.org/x/mod"
 
@@ -76,9 +63,11 @@ func ExampleClient() {
 }
 
 func TestClient(t *testing.T) {
-	client := proxy.NewClient(&HTTPClientOps{
-		BaseURL: "https://proxy.golang.org",
-	})
+	ops, err := proxy.NewHTTPOps("https://proxy.golang.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := proxy.NewClient(ops)
 
 	modulePath := "golang.org/x/mod"
 
@@ -125,3 +114,133 @@ func TestClient(t *testing.T) {
 		t.Fatal("expected non-empty zip file")
 	}
 }
+
+type blockingClientOps struct{}
+
+func (blockingClientOps) ReadRemote(p string) ([]byte, error) {
+	panic("ReadRemote called on ClientOpsContext")
+}
+
+func (blockingClientOps) ReadRemoteContext(ctx context.Context, p string) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingClientOps) Log(msg string) {}
+
+func TestRepo_Context(t *testing.T) {
+	client := proxy.NewClient(blockingClientOps{})
+	repo, err := client.Lookup("example.org/awesome")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = repo.VersionsContext(ctx, "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = repo.LatestContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	err = repo.ZipContext(ctx, io.Discard, "v1.0.0")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+type streamingClientOps struct {
+	files map[string][]byte
+}
+
+func (s *streamingClientOps) ReadRemote(p string) ([]byte, error) {
+	panic("ReadRemote called on ClientOpsOpenRemote")
+}
+
+func (s *streamingClientOps) OpenRemote(ctx context.Context, p string) (io.ReadCloser, error) {
+	data, ok := s.files[p]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *streamingClientOps) Log(msg string) {}
+
+type fsClientOps struct {
+	fstest.MapFS
+}
+
+func (f fsClientOps) ReadRemote(p string) ([]byte, error) {
+	panic("ReadRemote called on fs.FS")
+}
+
+func (f fsClientOps) Log(msg string) {}
+
+func TestRepo_ZipStreaming(t *testing.T) {
+	zipData := []byte("not really a zip")
+	for _, ops := range []proxy.ClientOps{
+		&streamingClientOps{files: map[string][]byte{
+			"/example.org/!awesome/@v/v1.0.0.zip": zipData,
+		}},
+		fsClientOps{fstest.MapFS{
+			"example.org/!awesome/@v/v1.0.0.zip": {Data: zipData},
+		}},
+	} {
+		t.Run(fmt.Sprintf("%T", ops), func(t *testing.T) {
+			repo, err := proxy.NewClient(ops).Lookup("example.org/Awesome")
+			if err != nil {
+				t.Fatal(err)
+			}
+			buffer := &bytes.Buffer{}
+			err = repo.Zip(buffer, "v1.0.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buffer.Bytes(), zipData) {
+				t.Fatalf("expected %q, got %q", zipData, buffer.Bytes())
+			}
+			err = repo.Zip(buffer, "v2.0.0")
+			if !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("expected fs.ErrNotExist, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRepo_LatestFallback(t *testing.T) {
+	tests := []struct {
+		list   string
+		latest string
+	}{
+		{list: "v0.9.0\nv1.0.0\nv1.1.0-rc.1\n", latest: "v1.0.0"},
+		{list: "v1.0.0-alpha\nv1.0.0-beta\n", latest: "v1.0.0-beta"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.latest, func(t *testing.T) {
+			// A proxy with no @latest.
+			ops := &countingClientOps{files: map[string][]byte{
+				"/example.org/a/@v/list": []byte(tt.list),
+			}}
+			for _, v := range strings.Fields(tt.list) {
+				ops.files["/example.org/a/@v/"+v+".info"] = []byte(`{"Version":"` + v + `"}`)
+			}
+			repo, err := proxy.NewClient(ops).Lookup("example.org/a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			latest, err := repo.Latest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if latest.Version != tt.latest {
+				t.Errorf("Latest = %s, want %s", latest.Version, tt.latest)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/mod/module"
+)
+
+// A Config holds the environment variables that decide how the go command
+// routes module lookups.
+//
+// https://go.dev/ref/mod#environment-variables
+type Config struct {
+	GOPROXY    string
+	GONOPROXY  string
+	GOPRIVATE  string
+	GOSUMDB    string
+	GONOSUMDB  string
+	GOINSECURE string
+	GOAUTH     string
+}
+
+// LoadConfig loads a Config the way 'go env' does: from the process
+// environment, then from the Go environment file (GOENV, by default
+// os.UserConfigDir()/go/env) for variables that are unset or empty.
+// GOPROXY, GOSUMDB and GOAUTH default to DefaultGOPROXY, DefaultGOSUMDB
+// and DefaultGOAUTH, and GONOPROXY and GONOSUMDB default to GOPRIVATE.
+func LoadConfig() (*Config, error) {
+	envFile, err := goEnvFile()
+	if err != nil {
+		return nil, err
+	}
+	return loadConfig(os.Getenv, envFile)
+}
+
+func loadConfig(getenv func(string) string, envFile map[string]string) (*Config, error) {
+	get := func(key string) string {
+		if v := getenv(key); v != "" {
+			return v
+		}
+		return envFile[key]
+	}
+	cfg := &Config{
+		GOPROXY:    get("GOPROXY"),
+		GONOPROXY:  get("GONOPROXY"),
+		GOPRIVATE:  get("GOPRIVATE"),
+		GOSUMDB:    get("GOSUMDB"),
+		GONOSUMDB:  get("GONOSUMDB"),
+		GOINSECURE: get("GOINSECURE"),
+		GOAUTH:     get("GOAUTH"),
+	}
+	if cfg.GOPROXY == "" {
+		cfg.GOPROXY = DefaultGOPROXY
+	}
+	if cfg.GOSUMDB == "" {
+		cfg.GOSUMDB = DefaultGOSUMDB
+	}
+	if cfg.GOAUTH == "" {
+		cfg.GOAUTH = DefaultGOAUTH
+	}
+	if cfg.GONOPROXY == "" {
+		cfg.GONOPROXY = cfg.GOPRIVATE
+	}
+	if cfg.GONOSUMDB == "" {
+		cfg.GONOSUMDB = cfg.GOPRIVATE
+	}
+	return cfg, nil
+}
+
+// goEnvFile reads the Go environment file. A missing file, or GOENV=off,
+// yields an empty map.
+func goEnvFile() (map[string]string, error) {
+	name := os.Getenv("GOENV")
+	if name == "off" {
+		return nil, nil
+	}
+	if name == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			// No config dir means no env file, same as the go command.
+			return nil, nil
+		}
+		name = filepath.Join(dir, "go", "env")
+	}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return parseGoEnv(data), nil
+}
+
+// parseGoEnv mirrors readEnvFile in cmd/go/internal/cfg.
+func parseGoEnv(data []byte) map[string]string {
+	m := map[string]string{}
+	for len(data) > 0 {
+		// Get next line.
+		line := data
+		i := bytes.IndexByte(data, '\n')
+		if i >= 0 {
+			line, data = line[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+
+		i = bytes.IndexByte(line, '=')
+		if i < 0 || line[0] < 'A' || 'Z' < line[0] {
+			// Line is missing = (or empty) or a comment or not a valid env name.
+			continue
+		}
+		key, val := line[:i], line[i+1:]
+		m[string(key)] = string(val)
+	}
+	return m
+}
+
+// NoProxy reports whether path matches GONOPROXY and so must not be
+// fetched through a proxy.
+func (cfg *Config) NoProxy(path string) bool {
+	return module.MatchPrefixPatterns(cfg.GONOPROXY, path)
+}
+
+// NoSumDB reports whether path must not be checked against the checksum
+// database, because GOSUMDB is off or path matches GONOSUMDB.
+func (cfg *Config) NoSumDB(path string) bool {
+	return cfg.GOSUMDB == "off" || module.MatchPrefixPatterns(cfg.GONOSUMDB, path)
+}
+
+// Insecure reports whether path matches GOINSECURE and so may be fetched
+// directly over an insecure scheme.
+func (cfg *Config) Insecure(path string) bool {
+	return module.MatchPrefixPatterns(cfg.GOINSECURE, path)
+}
+
+// NewHTTPOps returns an HTTPOps for cfg.GOPROXY that authenticates
+// according to cfg.GOAUTH.
+func (cfg *Config) NewHTTPOps() (*HTTPOps, error) {
+	ops, err := NewHTTPOps(cfg.GOPROXY)
+	if err != nil {
+		return nil, err
+	}
+	ops.Auth, err = NewAuth(cfg.GOAUTH)
+	if err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// NewSumDB returns a SumDB for cfg.GOSUMDB, or nil if GOSUMDB is off.
+func (cfg *Config) NewSumDB() (*SumDB, error) {
+	if cfg.GOSUMDB == "off" {
+		return nil, nil
+	}
+	return NewSumDB(cfg.GOSUMDB)
+}
@@ -0,0 +1,84 @@
+package proxy_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jcbhmr/xmod/proxy"
+)
+
+func setGoEnv(t *testing.T, data string) {
+	name := filepath.Join(t.TempDir(), "env")
+	err := os.WriteFile(name, []byte(data), 0o666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOENV", name)
+	for _, key := range []string{"GOPROXY", "GONOPROXY", "GOPRIVATE", "GOSUMDB", "GONOSUMDB", "GOINSECURE", "GOAUTH"} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	setGoEnv(t, "# comment\nGOPROXY=https://file.example\nGOPRIVATE=*.corp.example\nGOINSECURE=insecure.example\nnot a var\n")
+	t.Setenv("GOPROXY", "https://env.example,direct")
+
+	cfg, err := proxy.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := proxy.Config{
+		GOPROXY:    "https://env.example,direct",
+		GONOPROXY:  "*.corp.example",
+		GOPRIVATE:  "*.corp.example",
+		GOSUMDB:    proxy.DefaultGOSUMDB,
+		GONOSUMDB:  "*.corp.example",
+		GOINSECURE: "insecure.example",
+		GOAUTH:     proxy.DefaultGOAUTH,
+	}
+	if *cfg != want {
+		t.Fatalf("expected %+v, got %+v", want, *cfg)
+	}
+	if !cfg.NoProxy("git.corp.example/team/repo") || cfg.NoProxy("example.org/awesome") {
+		t.Fatal("NoProxy does not follow GOPRIVATE")
+	}
+	if !cfg.NoSumDB("git.corp.example/team/repo") {
+		t.Fatal("NoSumDB does not follow GOPRIVATE")
+	}
+	if !cfg.Insecure("insecure.example/foo") {
+		t.Fatal("Insecure does not follow GOINSECURE")
+	}
+}
+
+func TestLoadConfig_Defaults(t *testing.T) {
+	setGoEnv(t, "GONOSUMDB=nosum.example\n")
+	t.Setenv("GOPRIVATE", "private.example")
+
+	cfg, err := proxy.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.GOPROXY != proxy.DefaultGOPROXY {
+		t.Fatalf("expected GOPROXY %q, got %q", proxy.DefaultGOPROXY, cfg.GOPROXY)
+	}
+	if cfg.GONOPROXY != "private.example" {
+		t.Fatalf("expected GONOPROXY %q, got %q", "private.example", cfg.GONOPROXY)
+	}
+	if cfg.GONOSUMDB != "nosum.example" {
+		t.Fatalf("expected GONOSUMDB %q, got %q", "nosum.example", cfg.GONOSUMDB)
+	}
+}
+
+func TestNewClientConfig(t *testing.T) {
+	client := proxy.NewClientConfig(blockingClientOps{}, &proxy.Config{GOPRIVATE: "private.example", GONOPROXY: "private.example"})
+	_, err := client.Lookup("private.example/repo")
+	if !errors.Is(err, proxy.ErrGONOPROXY) {
+		t.Fatalf("expected %v, got %v", proxy.ErrGONOPROXY, err)
+	}
+	_, err = client.Lookup("example.org/awesome")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
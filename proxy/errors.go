@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+// Errors that an *Error matches according to its StatusCode. ServerOps
+// may also return them, or wrap them, to make a Server respond with the
+// corresponding status. ErrNotFound and ErrGone match fs.ErrNotExist.
+var (
+	ErrNotFound    error = statusError(http.StatusNotFound)
+	ErrGone        error = statusError(http.StatusGone)
+	ErrForbidden   error = statusError(http.StatusForbidden)
+	ErrUnavailable error = statusError(http.StatusServiceUnavailable)
+)
+
+type statusError int
+
+func (e statusError) Error() string {
+	return strings.ToLower(http.StatusText(int(e)))
+}
+
+func (e statusError) Is(target error) bool {
+	return target == fs.ErrNotExist && isNotExistStatus(int(e))
+}
+
+// isNotExistStatus reports whether a proxy responding with code means
+// that the module or version does not exist, so the next proxy in a
+// GOPROXY list may be tried.
+func isNotExistStatus(code int) bool {
+	return code == http.StatusNotFound || code == http.StatusGone
+}
+
+// An Error is an unsuccessful response from a module proxy, or from a
+// checksum database, in which case Op, Module and Version are empty.
+//
+// It matches whichever of ErrNotFound, ErrGone, ErrForbidden and
+// ErrUnavailable has its StatusCode, and matches fs.ErrNotExist if its
+// StatusCode is 404 or 410.
+type Error struct {
+	Op      string // "list", "latest", "info", "mod" or "zip"
+	Module  string // module path
+	Version string // module version, or "" for "list" and "latest"
+
+	// URL is the URL that was requested, or "" if unknown.
+	URL string
+
+	StatusCode int
+
+	// Body is the start of the response body, which proxies use for
+	// messages to the user.
+	Body string
+
+	// RetryAfter is the delay asked for by a Retry-After header, or 0.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	var buf strings.Builder
+	if e.URL != "" {
+		fmt.Fprintf(&buf, "reading %s: ", e.URL)
+	} else if e.Module != "" {
+		buf.WriteString(e.Module)
+		if e.Version != "" {
+			buf.WriteString("@" + e.Version)
+		}
+		fmt.Fprintf(&buf, ": %s: ", e.Op)
+	}
+	fmt.Fprintf(&buf, "%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Body != "" {
+		buf.WriteString("\n\t" + e.Body)
+	}
+	return buf.String()
+}
+
+func (e *Error) Is(target error) bool {
+	if target == fs.ErrNotExist {
+		return isNotExistStatus(e.StatusCode)
+	}
+	if se, ok := target.(statusError); ok {
+		return int(se) == e.StatusCode
+	}
+	return false
+}
+
+// parseRemotePath returns the Op, module path and version of a remote path
+// such as "/golang.org/x/mod/@v/v0.20.0.mod". It returns empty strings for
+// paths that are not part of the GOPROXY protocol.
+func parseRemotePath(p string) (op, modPath, version string) {
+	epath, rest, ok := strings.Cut(strings.TrimPrefix(p, "/"), "/@")
+	if !ok {
+		return "", "", ""
+	}
+	modPath, err := module.UnescapePath(epath)
+	if err != nil {
+		return "", "", ""
+	}
+	switch rest {
+	case "v/list":
+		return "list", modPath, ""
+	case "latest":
+		return "latest", modPath, ""
+	}
+	file, ok := strings.CutPrefix(rest, "v/")
+	if !ok {
+		return "", "", ""
+	}
+	ext := path.Ext(file)
+	switch ext {
+	case ".info", ".mod", ".zip":
+	default:
+		return "", "", ""
+	}
+	version, err = module.UnescapeVersion(strings.TrimSuffix(file, ext))
+	if err != nil {
+		return "", "", ""
+	}
+	return ext[1:], modPath, version
+}
+
+// errorStatus returns the HTTP status code and message a Server responds
+// with for err. An *Error with one of the statuses of ErrNotFound, ErrGone,
+// ErrForbidden and ErrUnavailable keeps its Body, so that it reaches the
+// client of the Server unchanged.
+func errorStatus(err error) (int, string) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrGone):
+		code = http.StatusGone
+	case errors.Is(err, ErrForbidden):
+		code = http.StatusForbidden
+	case errors.Is(err, ErrUnavailable):
+		code = http.StatusServiceUnavailable
+	case errors.Is(err, fs.ErrNotExist):
+		code = http.StatusNotFound
+	}
+	var pe *Error
+	if code != http.StatusInternalServerError && errors.As(err, &pe) {
+		return code, pe.Body
+	}
+	return code, err.Error()
+}
+
+// serveError responds to a request with the status errorStatus gives for
+// err, passing on the Retry-After delay of an *Error. Caching headers
+// already set for a successful response are removed.
+func serveError(w http.ResponseWriter, err error) {
+	code, msg := errorStatus(err)
+	for _, k := range []string{"Cache-Control", "ETag", "Last-Modified"} {
+		w.Header().Del(k)
+	}
+	var pe *Error
+	if errors.As(err, &pe) && pe.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64((pe.RetryAfter+time.Second-1)/time.Second), 10))
+	}
+	http.Error(w, msg, code)
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is
+// either a number of seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
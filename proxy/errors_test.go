@@ -0,0 +1,144 @@
+package proxy_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcbhmr/xmod/proxy"
+	"golang.org/x/mod/module"
+)
+
+// errorServerOps fails every request with err.
+type errorServerOps struct {
+	err error
+}
+
+func (e errorServerOps) Versions(ctx context.Context, path string) ([]string, error) {
+	return nil, e.err
+}
+
+func (e errorServerOps) Stat(ctx context.Context, m module.Version) (*proxy.RevInfo, error) {
+	return nil, e.err
+}
+
+func (e errorServerOps) GoMod(ctx context.Context, m module.Version) ([]byte, error) {
+	return nil, e.err
+}
+
+func (e errorServerOps) Zip(ctx context.Context, dst io.Writer, m module.Version) error {
+	return e.err
+}
+
+func TestError_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		sentinel   error
+		statusCode int
+		body       string
+		retryAfter time.Duration
+		notExist   bool
+	}{
+		{name: "not found", err: fs.ErrNotExist, sentinel: proxy.ErrNotFound, statusCode: 404, body: "file does not exist", notExist: true},
+		{name: "gone", err: &proxy.Error{StatusCode: 410, Body: "removed by the author"}, sentinel: proxy.ErrGone, statusCode: 410, body: "removed by the author", notExist: true},
+		{name: "forbidden", err: proxy.ErrForbidden, sentinel: proxy.ErrForbidden, statusCode: 403, body: "forbidden"},
+		{name: "unavailable", err: &proxy.Error{StatusCode: 503, Body: "try again later", RetryAfter: 30 * time.Second}, sentinel: proxy.ErrUnavailable, statusCode: 503, body: "try again later", retryAfter: 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(proxy.NewServer(errorServerOps{tt.err}))
+			defer server.Close()
+			ops, err := proxy.NewHTTPOps(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo, err := proxy.NewClient(ops).Lookup("example.org/Awesome")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checks := []struct {
+				op, version string
+				err         error
+			}{
+				{op: "info", version: "v1.0.0"},
+				{op: "mod", version: "v1.0.0"},
+				{op: "zip", version: "v1.0.0"},
+			}
+			_, checks[0].err = repo.Stat("v1.0.0")
+			_, checks[1].err = repo.GoMod("v1.0.0")
+			checks[2].err = repo.Zip(io.Discard, "v1.0.0")
+			for _, c := range checks {
+				var pe *proxy.Error
+				if !errors.As(c.err, &pe) {
+					t.Fatalf("%s: expected *proxy.Error, got %T %v", c.op, c.err, c.err)
+				}
+				if pe.Op != c.op || pe.Module != "example.org/Awesome" || pe.Version != c.version {
+					t.Errorf("%s: got Op=%q Module=%q Version=%q", c.op, pe.Op, pe.Module, pe.Version)
+				}
+				if pe.StatusCode != tt.statusCode || pe.Body != tt.body {
+					t.Errorf("%s: got StatusCode=%d Body=%q, want %d %q", c.op, pe.StatusCode, pe.Body, tt.statusCode, tt.body)
+				}
+				if pe.RetryAfter != tt.retryAfter {
+					t.Errorf("%s: got RetryAfter=%v, want %v", c.op, pe.RetryAfter, tt.retryAfter)
+				}
+				if !errors.Is(c.err, tt.sentinel) {
+					t.Errorf("%s: errors.Is(%v, %v) = false", c.op, c.err, tt.sentinel)
+				}
+				if errors.Is(c.err, fs.ErrNotExist) != tt.notExist {
+					t.Errorf("%s: errors.Is(%v, fs.ErrNotExist) = %v", c.op, c.err, !tt.notExist)
+				}
+			}
+		})
+	}
+}
+
+func TestError_Is(t *testing.T) {
+	err := &proxy.Error{Op: "mod", Module: "example.org/awesome", Version: "v1.0.0", StatusCode: 404}
+	if !errors.Is(err, proxy.ErrNotFound) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("404 error does not match ErrNotFound and fs.ErrNotExist")
+	}
+	if errors.Is(err, proxy.ErrGone) || errors.Is(err, proxy.ErrForbidden) || errors.Is(err, proxy.ErrUnavailable) {
+		t.Errorf("404 error matches another status")
+	}
+	if got, want := err.Error(), "example.org/awesome@v1.0.0: mod: 404 Not Found"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if errors.Is(proxy.ErrForbidden, fs.ErrNotExist) {
+		t.Errorf("ErrForbidden matches fs.ErrNotExist")
+	}
+}
+
+// wrappingClientOps fails every read with a wrapped *proxy.Error.
+type wrappingClientOps struct{}
+
+func (wrappingClientOps) ReadRemote(path string) ([]byte, error) {
+	return nil, fmt.Errorf("mirror: %w", &proxy.Error{URL: "https://mirror.example" + path, StatusCode: 404})
+}
+
+func (wrappingClientOps) Log(msg string) {}
+
+func TestError_Wrapped(t *testing.T) {
+	repo, err := proxy.NewClient(wrappingClientOps{}).Lookup("example.org/awesome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GoMod("v1.0.0")
+	var pe *proxy.Error
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected *proxy.Error, got %T %v", err, err)
+	}
+	if pe.Op != "mod" || pe.Module != "example.org/awesome" || pe.Version != "v1.0.0" {
+		t.Errorf("got Op=%q Module=%q Version=%q", pe.Op, pe.Module, pe.Version)
+	}
+	if !strings.HasPrefix(err.Error(), "mirror: ") || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("wrapping lost: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"context"
+	"os"
+
+	xzip "github.com/jcbhmr/xmod/zip"
+	"golang.org/x/mod/module"
+)
+
+// Extract downloads the zip of the given version and extracts it into
+// dir, which must not exist yet. See zip.Extract for how the zip is
+// checked and how dir is written.
+func (r *Repo) Extract(version, dir string) error {
+	return r.ExtractContext(context.Background(), version, dir)
+}
+
+func (r *Repo) ExtractContext(ctx context.Context, version, dir string) error {
+	f, err := os.CreateTemp("", "modzip-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	err = r.ZipContext(ctx, f, version)
+	if err != nil {
+		return err
+	}
+	_, err = f.Seek(0, 0)
+	if err != nil {
+		return err
+	}
+	return xzip.Extract(dir, module.Version{Path: r.path, Version: version}, f)
+}
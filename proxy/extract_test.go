@@ -0,0 +1,108 @@
+package proxy_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jcbhmr/xmod/proxy"
+	"golang.org/x/mod/module"
+)
+
+func TestRepo_Extract(t *testing.T) {
+	m := module.Version{Path: "example.org/awesome", Version: "v1.0.0"}
+	evil := module.Version{Path: "example.org/awesome", Version: "v1.0.1"}
+	var evilZip bytes.Buffer
+	zw := zip.NewWriter(&evilZip)
+	for _, name := range []string{"example.org/awesome@v1.0.1/go.mod", "example.org/awesome@v1.0.1/../../escaped.go"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("module example.org/awesome\n"))
+	}
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := proxy.NewClient(&countingClientOps{files: map[string][]byte{
+		"/example.org/awesome/@v/v1.0.0.zip": makeModuleZip(t, m, fstest.MapFS{
+			"go.mod":          {Data: []byte("module example.org/awesome\n")},
+			"awesome.go":      {Data: []byte("package awesome\n")},
+			"sub/internal.go": {Data: []byte("package sub\n")},
+		}),
+		"/example.org/awesome/@v/v1.0.1.zip": evilZip.Bytes(),
+	}}).Lookup(m.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	t.Cleanup(func() {
+		// Let t.TempDir remove the read-only directories.
+		filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				os.Chmod(path, 0o777)
+			}
+			return nil
+		})
+	})
+	dir := filepath.Join(root, "example.org", "awesome@v1.0.0")
+	err = repo.Extract(m.Version, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"go.mod":          "module example.org/awesome\n",
+		"awesome.go":      "package awesome\n",
+		"sub/internal.go": "package sub\n",
+	} {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s: got %q, want %q", name, data, want)
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm()&0o222 != 0 {
+			t.Errorf("%s: mode %v is writable", name, info.Mode())
+		}
+	}
+	info, err := os.Stat(filepath.Join(dir, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0o222 != 0 {
+		t.Errorf("sub: mode %v is writable", info.Mode())
+	}
+
+	err = repo.Extract(m.Version, dir)
+	if err == nil {
+		t.Error("expected error extracting into an existing directory")
+	}
+
+	evilDir := filepath.Join(root, "example.org", "awesome@v1.0.1")
+	err = repo.Extract(evil.Version, evilDir)
+	if err == nil {
+		t.Fatal("expected error for a zip with a path outside the module")
+	}
+	if _, err := os.Stat(filepath.Join(root, "escaped.go")); err == nil {
+		t.Error("file escaped the target directory")
+	}
+	entries, err := os.ReadDir(filepath.Join(root, "example.org"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only awesome@v1.0.0 to remain, got %v", entries)
+	}
+}
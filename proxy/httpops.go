@@ -0,0 +1,335 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultGOPROXY is the GOPROXY value used when none is set.
+const DefaultGOPROXY = "https://proxy.golang.org,direct"
+
+var (
+	// ErrGOPROXYOff is returned for lookups that reach an "off" entry
+	// in the GOPROXY list, unless a proxy before it returned an error,
+	// which is returned instead.
+	ErrGOPROXYOff error = notExistError("module lookup disabled by GOPROXY=off")
+
+	// ErrGOPROXYDirect is returned, like ErrGOPROXYOff, for lookups that
+	// reach a "direct" entry in the GOPROXY list. HTTPOps cannot fetch modules from
+	// version control, so callers that can should handle it themselves.
+	// Like ErrGOPROXYOff, it matches fs.ErrNotExist.
+	ErrGOPROXYDirect error = notExistError("fetching from version control (GOPROXY=direct) is not supported")
+)
+
+type notExistError string
+
+func (e notExistError) Error() string {
+	return string(e)
+}
+
+func (e notExistError) Is(target error) bool {
+	return target == fs.ErrNotExist
+}
+
+// HTTPOps is a ClientOps that reads from the proxies in a GOPROXY list,
+// falling back from one to the next the way the go command does.
+//
+// https://go.dev/ref/mod#goproxy-protocol
+type HTTPOps struct {
+	// Client is used for HTTP requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// Logger receives the messages passed to Log. If nil, they are discarded.
+	Logger *log.Logger
+
+	// Header holds headers to send with requests, keyed by URL prefix,
+	// such as "https://goproxy.example.com/private/". A request gets the
+	// headers of the longest prefix of its URL that ends at a path
+	// element boundary.
+	Header map[string]http.Header
+
+	// Auth, if not nil, adds credentials from .netrc files and GOAUTH
+	// commands to HTTPS requests.
+	Auth *Auth
+
+	proxies []proxySpec
+}
+
+type proxySpec struct {
+	// url is a proxy URL, "direct" or "off".
+	url string
+
+	// fallBackOnError is true if the next proxy should be tried after any
+	// error, not just fs.ErrNotExist. It is set by a following "|".
+	fallBackOnError bool
+}
+
+// NewHTTPOps returns an HTTPOps for the given GOPROXY list. An empty list
+// means DefaultGOPROXY.
+func NewHTTPOps(goproxy string) (*HTTPOps, error) {
+	proxies, err := parseGOPROXY(goproxy)
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPOps{proxies: proxies}, nil
+}
+
+// parseGOPROXY mirrors proxyList in cmd/go/internal/modfetch.
+func parseGOPROXY(goproxy string) ([]proxySpec, error) {
+	if goproxy == "" {
+		goproxy = DefaultGOPROXY
+	}
+	var proxies []proxySpec
+	for goproxy != "" {
+		var u string
+		fallBackOnError := false
+		if i := strings.IndexAny(goproxy, ",|"); i >= 0 {
+			u = goproxy[:i]
+			fallBackOnError = goproxy[i] == '|'
+			goproxy = goproxy[i+1:]
+		} else {
+			u = goproxy
+			goproxy = ""
+		}
+
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		if u == "off" {
+			// "off" always fails hard, so can stop walking list.
+			proxies = append(proxies, proxySpec{url: "off"})
+			break
+		}
+		if u == "direct" {
+			proxies = append(proxies, proxySpec{url: "direct"})
+			// For now, "direct" is the end of the line. We may decide to add some
+			// sort of fallback behavior for them in the future, so ignore
+			// subsequent entries for forward-compatibility.
+			break
+		}
+
+		// Single-word tokens are reserved for built-in behaviors, and anything
+		// containing the string ":/" or matching an absolute file path must be a
+		// complete URL. For all other paths, implicitly add "https://".
+		if strings.ContainsAny(u, ".:/") && !strings.Contains(u, ":/") && !filepath.IsAbs(u) && !path.IsAbs(u) {
+			u = "https://" + u
+		}
+		base, err := url.Parse(u)
+		if err != nil {
+			return nil, err
+		}
+		switch base.Scheme {
+		case "http", "https", "file":
+		case "":
+			return nil, fmt.Errorf("invalid GOPROXY entry %q: missing scheme", u)
+		default:
+			return nil, fmt.Errorf("invalid GOPROXY entry %q: unsupported scheme %q", u, base.Scheme)
+		}
+		proxies = append(proxies, proxySpec{url: strings.TrimSuffix(u, "/"), fallBackOnError: fallBackOnError})
+	}
+	if len(proxies) == 0 {
+		return nil, fmt.Errorf("GOPROXY list is not the empty string, but contains no entries")
+	}
+	return proxies, nil
+}
+
+func (h *HTTPOps) ReadRemote(path string) ([]byte, error) {
+	return h.ReadRemoteContext(context.Background(), path)
+}
+
+func (h *HTTPOps) ReadRemoteContext(ctx context.Context, path string) ([]byte, error) {
+	data, _, err := h.ReadRemoteUpstream(ctx, path)
+	return data, err
+}
+
+// ReadRemoteUpstream is like ReadRemoteContext, but also reports which
+// entry of the GOPROXY list answered.
+func (h *HTTPOps) ReadRemoteUpstream(ctx context.Context, path string) (data []byte, upstream string, err error) {
+	err = h.tryProxies(func(proxy string) error {
+		var err error
+		data, err = h.get(ctx, proxy, path)
+		if err == nil {
+			upstream = proxy
+			noteUpstream(ctx, proxy)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return data, upstream, nil
+}
+
+func (h *HTTPOps) OpenRemote(ctx context.Context, path string) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := h.tryProxies(func(proxy string) error {
+		var err error
+		rc, err = h.open(ctx, proxy, path)
+		if err == nil {
+			noteUpstream(ctx, proxy)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+func (h *HTTPOps) Log(msg string) {
+	if h.Logger != nil {
+		h.Logger.Print(msg)
+	}
+}
+
+// tryProxies mirrors TryProxies in cmd/go/internal/modfetch. It calls f
+// for each proxy in turn until one succeeds or the list says to stop, and
+// returns the most helpful error.
+func (h *HTTPOps) tryProxies(f func(proxy string) error) error {
+	// We try to report the most helpful error to the user. Proxy errors
+	// other than fs.ErrNotExist are best, followed by fs.ErrNotExist, such
+	// as a 404 or 410 from a proxy. ErrGOPROXYOff and ErrGOPROXYDirect say
+	// nothing about the module, so they come last.
+	const (
+		placeholderRank = iota
+		notExistRank
+		proxyRank
+	)
+	var bestErr error
+	bestErrRank := placeholderRank
+	for i, proxy := range h.proxies {
+		err := f(proxy.url)
+		if err == nil {
+			return nil
+		}
+		isNotExistErr := errors.Is(err, fs.ErrNotExist)
+
+		rank := proxyRank
+		if err == ErrGOPROXYOff || err == ErrGOPROXYDirect {
+			rank = placeholderRank
+		} else if isNotExistErr {
+			rank = notExistRank
+		}
+		if bestErr == nil || rank >= bestErrRank {
+			bestErr = err
+			bestErrRank = rank
+		}
+
+		if !proxy.fallBackOnError && !isNotExistErr {
+			break
+		}
+		if i < len(h.proxies)-1 {
+			h.Log(fmt.Sprintf("%v; trying next GOPROXY entry", err))
+		}
+	}
+	return bestErr
+}
+
+func (h *HTTPOps) get(ctx context.Context, proxy, p string) ([]byte, error) {
+	rc, err := h.open(ctx, proxy, p)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func (h *HTTPOps) open(ctx context.Context, proxy, p string) (io.ReadCloser, error) {
+	switch proxy {
+	case "off":
+		return nil, ErrGOPROXYOff
+	case "direct":
+		return nil, ErrGOPROXYDirect
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	u := proxy + p
+	if strings.HasPrefix(u, "file:") {
+		fu, err := url.Parse(u)
+		if err != nil {
+			return nil, err
+		}
+		name := fu.Path
+		if filepath.Separator != '/' {
+			name = filepath.FromSlash(strings.TrimPrefix(name, "/"))
+		}
+		return os.Open(name)
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := h.newRequest(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if h.Auth != nil {
+		h.Auth.addCredentials(ctx, req, nil)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && h.Auth != nil {
+		// Retry with the credentials that GOAUTH gives for the failure.
+		req, err := h.newRequest(ctx, u)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if h.Auth.addCredentials(ctx, req, resp) {
+			resp.Body.Close()
+			resp, err = client.Do(req)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		// Include a snippet of the body, like the go command does for
+		// messages from proxies.
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		op, modPath, version := parseRemotePath(p)
+		return nil, &Error{
+			Op:         op,
+			Module:     modPath,
+			Version:    version,
+			URL:        u,
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(string(body)),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	return resp.Body, nil
+}
+
+// newRequest returns a GET request for u with the headers that h.Header
+// holds for it.
+func (h *HTTPOps) newRequest(ctx context.Context, u string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range matchHeader(h.Header, u) {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	return req, nil
+}
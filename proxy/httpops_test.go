@@ -0,0 +1,148 @@
+package proxy_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jcbhmr/xmod/proxy"
+)
+
+func statusServer(t *testing.T, status int, body string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPOps_Fallback(t *testing.T) {
+	notFound := statusServer(t, http.StatusNotFound, "not found")
+	gone := statusServer(t, http.StatusGone, "gone")
+	broken := statusServer(t, http.StatusInternalServerError, "broken")
+	ok := statusServer(t, http.StatusOK, "v1.0.0\n")
+
+	tests := []struct {
+		name     string
+		goproxy  string
+		upstream string
+		notExist bool
+		errText  string
+		status   int
+	}{
+		{name: "comma 404", goproxy: notFound.URL + "," + ok.URL, upstream: ok.URL},
+		{name: "comma 410", goproxy: gone.URL + "," + ok.URL, upstream: ok.URL},
+		{name: "comma 500", goproxy: broken.URL + "," + ok.URL, errText: "500"},
+		{name: "pipe 500", goproxy: broken.URL + "|" + ok.URL, upstream: ok.URL},
+		{name: "pipe then comma", goproxy: broken.URL + "|" + notFound.URL + "," + ok.URL, upstream: ok.URL},
+		{name: "best error", goproxy: broken.URL + "|" + notFound.URL, errText: "500"},
+		{name: "off", goproxy: "off", notExist: true, errText: "GOPROXY=off"},
+		{name: "off after 404", goproxy: notFound.URL + ",off," + ok.URL, notExist: true, errText: "404", status: 404},
+		{name: "direct after 404", goproxy: notFound.URL + ",direct", notExist: true, errText: "404", status: 404},
+		{name: "direct after 410", goproxy: gone.URL + ",direct", notExist: true, errText: "410", status: 410},
+		{name: "direct", goproxy: "direct", notExist: true, errText: "GOPROXY=direct"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := proxy.NewHTTPOps(tt.goproxy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, upstream, err := ops.ReadRemoteUpstream(context.Background(), "/example.org/awesome/@v/list")
+			if tt.errText != "" {
+				if err == nil {
+					t.Fatalf("expected error containing %q, got nil", tt.errText)
+				}
+				if !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("expected error containing %q, got %v", tt.errText, err)
+				}
+				if errors.Is(err, fs.ErrNotExist) != tt.notExist {
+					t.Fatalf("errors.Is(%v, fs.ErrNotExist) = %v, want %v", err, !tt.notExist, tt.notExist)
+				}
+				if tt.status != 0 {
+					var pe *proxy.Error
+					if !errors.As(err, &pe) || pe.StatusCode != tt.status || pe.Module != "example.org/awesome" {
+						t.Fatalf("expected the proxy's %d *proxy.Error, got %#v", tt.status, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if upstream != tt.upstream {
+				t.Fatalf("expected upstream %s, got %s", tt.upstream, upstream)
+			}
+			if string(data) != "v1.0.0\n" {
+				t.Fatalf("unexpected data %q", data)
+			}
+		})
+	}
+}
+
+func TestHTTPOps_File(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "example.org", "awesome", "@v"), 0o777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "example.org", "awesome", "@v", "list"), []byte("v1.0.0\n"), 0o666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops, err := proxy.NewHTTPOps("file://" + filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ops.ReadRemote("/example.org/awesome/@v/list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "v1.0.0\n" {
+		t.Fatalf("unexpected data %q", data)
+	}
+	_, err = ops.ReadRemote("/example.org/missing/@v/list")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestNewHTTPOps_Invalid(t *testing.T) {
+	for _, goproxy := range []string{",", "ftp://example.org"} {
+		_, err := proxy.NewHTTPOps(goproxy)
+		if err == nil {
+			t.Errorf("NewHTTPOps(%q): expected error", goproxy)
+		}
+	}
+}
+
+func TestHTTPOps_OpenRemote(t *testing.T) {
+	notFound := statusServer(t, http.StatusNotFound, "not found")
+	ok := statusServer(t, http.StatusOK, "zip data")
+
+	ops, err := proxy.NewHTTPOps(notFound.URL + "," + ok.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := ops.OpenRemote(context.Background(), "/example.org/awesome/@v/v1.0.0.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "zip data" {
+		t.Fatalf("unexpected data %q", data)
+	}
+}
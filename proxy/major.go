@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// A MajorVersion is one major version series of a module.
+type MajorVersion struct {
+	Path   string   // module path of the series, such as "example.com/foo/v2"
+	Major  int      // major version; 1 for the v0/v1 series outside gopkg.in
+	Latest *RevInfo // latest version in the series
+}
+
+// MajorVersions returns the major version series of the module with the
+// given path, in increasing order. It probes the path with each "/vN"
+// suffix (or ".vN" for gopkg.in) in turn, from the lowest series, and
+// stops once majorVersionGap series in a row, from the major version of
+// path up, are missing, so that a skipped major version, such as v3
+// following v1, does not hide the later series.
+//
+// The Latest of the v0/v1 series is never a +incompatible version, such
+// as v2.0.0+incompatible. A module with only +incompatible versions has no
+// v0/v1 series.
+func (c *Client) MajorVersions(path string) ([]MajorVersion, error) {
+	return c.MajorVersionsContext(context.Background(), path)
+}
+
+// majorVersionGap is how many missing series in a row end the probing of
+// MajorVersions.
+const majorVersionGap = 3
+
+func (c *Client) MajorVersionsContext(ctx context.Context, path string) ([]MajorVersion, error) {
+	prefix, pathMajor, ok := module.SplitPathVersion(path)
+	if !ok {
+		return nil, fmt.Errorf("invalid module path %q", path)
+	}
+	gopkgin := strings.HasPrefix(path, "gopkg.in/")
+	current := 1
+	if pathMajor != "" {
+		n, err := strconv.Atoi(pathMajor[2:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid module path %q", path)
+		}
+		current = n
+	}
+
+	start := 1
+	if gopkgin && current == 0 {
+		start = 0
+	}
+	var majors []MajorVersion
+	missing := 0
+	for n := start; ; n++ {
+		var p string
+		switch {
+		case gopkgin:
+			p = prefix + ".v" + strconv.Itoa(n)
+		case n == 1:
+			p = prefix
+		default:
+			p = prefix + "/v" + strconv.Itoa(n)
+		}
+		repo, err := c.Lookup(p)
+		if err != nil {
+			return nil, err
+		}
+		latest, err := repo.LatestContext(ctx)
+		if err == nil && semver.Build(latest.Version) == "+incompatible" {
+			latest, err = repo.QueryContext(ctx, "<v2", "")
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			if n >= current {
+				missing++
+				if missing == majorVersionGap {
+					break
+				}
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		missing = 0
+		majors = append(majors, MajorVersion{Path: p, Major: n, Latest: latest})
+	}
+	return majors, nil
+}
@@ -0,0 +1,59 @@
+package proxy_test
+
+import (
+	"testing"
+
+	"github.com/jcbhmr/xmod/proxy"
+)
+
+func TestClient_MajorVersions(t *testing.T) {
+	ops := &countingClientOps{files: map[string][]byte{
+		"/example.org/foo/@latest":    []byte(`{"Version":"v1.5.0"}`),
+		"/example.org/foo/v2/@latest": []byte(`{"Version":"v2.1.0"}`),
+		"/example.org/foo/v3/@latest": []byte(`{"Version":"v3.0.0"}`),
+		"/gopkg.in/yaml.v1/@latest":   []byte(`{"Version":"v1.0.0"}`),
+		// v2 was never published as a module, only as +incompatible.
+		"/example.org/bar/@latest":        []byte(`{"Version":"v2.0.0+incompatible"}`),
+		"/example.org/bar/@v/list":        []byte("v1.2.0\nv2.0.0+incompatible\n"),
+		"/example.org/bar/@v/v1.2.0.info": []byte(`{"Version":"v1.2.0"}`),
+		"/example.org/bar/v3/@latest":     []byte(`{"Version":"v3.1.0"}`),
+		"/gopkg.in/yaml.v2/@latest":       []byte(`{"Version":"v2.4.0"}`),
+	}}
+	client := proxy.NewClient(ops)
+
+	tests := []struct {
+		path string
+		want []proxy.MajorVersion
+	}{
+		{"example.org/foo", []proxy.MajorVersion{
+			{Path: "example.org/foo", Major: 1, Latest: &proxy.RevInfo{Version: "v1.5.0"}},
+			{Path: "example.org/foo/v2", Major: 2, Latest: &proxy.RevInfo{Version: "v2.1.0"}},
+			{Path: "example.org/foo/v3", Major: 3, Latest: &proxy.RevInfo{Version: "v3.0.0"}},
+		}},
+		{"example.org/bar", []proxy.MajorVersion{
+			{Path: "example.org/bar", Major: 1, Latest: &proxy.RevInfo{Version: "v1.2.0"}},
+			{Path: "example.org/bar/v3", Major: 3, Latest: &proxy.RevInfo{Version: "v3.1.0"}},
+		}},
+		{"gopkg.in/yaml.v2", []proxy.MajorVersion{
+			{Path: "gopkg.in/yaml.v1", Major: 1, Latest: &proxy.RevInfo{Version: "v1.0.0"}},
+			{Path: "gopkg.in/yaml.v2", Major: 2, Latest: &proxy.RevInfo{Version: "v2.4.0"}},
+		}},
+		{"example.org/missing", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := client.MajorVersions(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d series, got %d", len(tt.want), len(got))
+			}
+			for i := range got {
+				if got[i].Path != tt.want[i].Path || got[i].Major != tt.want[i].Major || got[i].Latest.Version != tt.want[i].Latest.Version {
+					t.Errorf("series %d: expected %+v %s, got %+v %s", i, tt.want[i], tt.want[i].Latest.Version, got[i], got[i].Latest.Version)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/module"
+)
+
+// A PackageNotFoundError reports an import path that no module provides
+// at the queried version. It matches fs.ErrNotExist.
+type PackageNotFoundError struct {
+	ImportPath, Query string
+}
+
+func (e *PackageNotFoundError) Error() string {
+	return fmt.Sprintf("no module provides package %s at %s", e.ImportPath, e.Query)
+}
+
+func (e *PackageNotFoundError) Is(target error) bool {
+	return target == fs.ErrNotExist
+}
+
+// An AmbiguousImportError reports an import path that more than one
+// module provides.
+type AmbiguousImportError struct {
+	ImportPath string
+	Modules    []module.Version
+}
+
+func (e *AmbiguousImportError) Error() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "ambiguous import: found package %s in multiple modules:", e.ImportPath)
+	for _, m := range e.Modules {
+		fmt.Fprintf(&buf, "\n\t%s %s", m.Path, m.Version)
+	}
+	return buf.String()
+}
+
+// ModuleForPackage returns the module that provides the package with the
+// given import path at the given query (see Repo.Query; "" means
+// "latest").
+//
+// Like 'go get', it tries every prefix of importPath as a module path, in
+// parallel, and downloads the zip of each module found to check that it
+// contains the package directory with at least one .go file. If more than
+// one module does, the result is an *AmbiguousImportError.
+func (c *Client) ModuleForPackage(ctx context.Context, importPath, query string) (module.Version, error) {
+	if query == "" {
+		query = "latest"
+	}
+	if err := module.CheckImportPath(importPath); err != nil {
+		return module.Version{}, err
+	}
+
+	var candidates []string
+	for p := importPath; p != "."; p = path.Dir(p) {
+		if module.CheckPath(p) == nil {
+			candidates = append(candidates, p)
+		}
+	}
+
+	type result struct {
+		m     module.Version
+		found bool
+		err   error
+	}
+	results := make([]result, len(candidates))
+	var wg sync.WaitGroup
+	for i, p := range candidates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m, found, err := c.providesPackage(ctx, p, importPath, query)
+			results[i] = result{m, found, err}
+		}()
+	}
+	wg.Wait()
+
+	var found []module.Version
+	var firstErr error
+	for _, r := range results {
+		if r.found {
+			found = append(found, r.m)
+		} else if r.err != nil && !errors.Is(r.err, fs.ErrNotExist) && firstErr == nil {
+			firstErr = r.err
+		}
+	}
+	switch {
+	case len(found) == 1:
+		return found[0], nil
+	case len(found) > 1:
+		return module.Version{}, &AmbiguousImportError{ImportPath: importPath, Modules: found}
+	case firstErr != nil:
+		return module.Version{}, firstErr
+	}
+	return module.Version{}, &PackageNotFoundError{ImportPath: importPath, Query: query}
+}
+
+// providesPackage reports whether the module modPath at query contains
+// the package importPath.
+func (c *Client) providesPackage(ctx context.Context, modPath, importPath, query string) (module.Version, bool, error) {
+	repo, err := c.Lookup(modPath)
+	if err != nil {
+		return module.Version{}, false, err
+	}
+	ri, err := repo.QueryContext(ctx, query, "")
+	if err != nil {
+		return module.Version{}, false, err
+	}
+	m := module.Version{Path: modPath, Version: ri.Version}
+
+	f, err := os.CreateTemp("", "modzip-*.zip")
+	if err != nil {
+		return m, false, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	err = repo.ZipContext(ctx, f, m.Version)
+	if err != nil {
+		return m, false, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return m, false, err
+	}
+	z, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		return m, false, err
+	}
+
+	dir := m.Path + "@" + m.Version + "/"
+	if rel := strings.TrimPrefix(importPath, m.Path); rel != "" {
+		dir += strings.TrimPrefix(rel, "/") + "/"
+	}
+	for _, zf := range z.File {
+		name, ok := strings.CutPrefix(zf.Name, dir)
+		if ok && !strings.Contains(name, "/") && strings.HasSuffix(name, ".go") {
+			return m, true, nil
+		}
+	}
+	return m, false, nil
+}
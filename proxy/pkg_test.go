@@ -0,0 +1,74 @@
+package proxy_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jcbhmr/xmod/proxy"
+	"golang.org/x/mod/module"
+)
+
+func TestClient_ModuleForPackage(t *testing.T) {
+	ops := &countingClientOps{files: map[string][]byte{}}
+	addModule := func(m module.Version, files fstest.MapFS) {
+		p := "/" + m.Path + "/@v/"
+		ops.files[p+"list"] = []byte(m.Version + "\n")
+		ops.files[p+m.Version+".info"] = []byte(fmt.Sprintf(`{"Version":%q}`, m.Version))
+		ops.files[p+m.Version+".mod"] = []byte("module " + m.Path + "\n")
+		ops.files[p+m.Version+".zip"] = makeModuleZip(t, m, files)
+	}
+	addModule(module.Version{Path: "example.org/mono", Version: "v1.0.0"}, fstest.MapFS{
+		"go.mod":        {Data: []byte("module example.org/mono\n")},
+		"mono.go":       {Data: []byte("package mono\n")},
+		"a/b/b.go":      {Data: []byte("package b\n")},
+		"docs/index.md": {Data: []byte("# docs\n")},
+	})
+	addModule(module.Version{Path: "example.org/split", Version: "v1.0.0"}, fstest.MapFS{
+		"go.mod":     {Data: []byte("module example.org/split\n")},
+		"sub/sub.go": {Data: []byte("package sub\n")},
+	})
+	addModule(module.Version{Path: "example.org/split/sub", Version: "v1.1.0"}, fstest.MapFS{
+		"go.mod": {Data: []byte("module example.org/split/sub\n")},
+		"sub.go": {Data: []byte("package sub\n")},
+	})
+	client := proxy.NewClient(ops)
+	ctx := context.Background()
+
+	tests := []struct {
+		importPath string
+		want       module.Version
+	}{
+		{"example.org/mono", module.Version{Path: "example.org/mono", Version: "v1.0.0"}},
+		{"example.org/mono/a/b", module.Version{Path: "example.org/mono", Version: "v1.0.0"}},
+	}
+	for _, tt := range tests {
+		got, err := client.ModuleForPackage(ctx, tt.importPath, "")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.importPath, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s: expected %v, got %v", tt.importPath, tt.want, got)
+		}
+	}
+
+	for _, importPath := range []string{"example.org/mono/a", "example.org/mono/docs", "example.org/nowhere/pkg"} {
+		_, err := client.ModuleForPackage(ctx, importPath, "")
+		var notFound *proxy.PackageNotFoundError
+		if !errors.As(err, &notFound) || !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: expected *PackageNotFoundError, got %v", importPath, err)
+		}
+	}
+
+	_, err := client.ModuleForPackage(ctx, "example.org/split/sub", "")
+	var ambiguous *proxy.AmbiguousImportError
+	if !errors.As(err, &ambiguous) {
+		t.Fatalf("expected *AmbiguousImportError, got %v", err)
+	}
+	if len(ambiguous.Modules) != 2 {
+		t.Fatalf("expected 2 modules, got %v", ambiguous.Modules)
+	}
+}
@@ -0,0 +1,469 @@
+// Package proxytest checks that a module proxy implements the GOPROXY
+// protocol, whether it is a proxy.Server with its own ServerOps or a
+// third-party mirror.
+//
+// https://go.dev/ref/mod#goproxy-protocol
+package proxytest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jcbhmr/xmod/proxy"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	modzip "golang.org/x/mod/zip"
+)
+
+// Want describes what the proxy under test is expected to serve.
+type Want struct {
+	// Modules are the module versions the proxy must serve. Versions
+	// that are not pseudo-versions must also be in the list of their
+	// module.
+	Modules []Module
+
+	// Latest maps module paths to the version that @latest must report.
+	// For a module of Modules that is not in Latest, @latest must report
+	// some valid version of the module.
+	Latest map[string]string
+
+	// NotFound are module versions that the proxy must answer with 404
+	// Not Found or 410 Gone. A Version of "" stands for the whole
+	// module, whose list must not be found.
+	NotFound []module.Version
+
+	// Gone are module versions that the proxy must answer with 410 Gone.
+	Gone []module.Version
+}
+
+// A Module is a module version that the proxy under test must serve.
+type Module struct {
+	Mod module.Version
+
+	// GoMod, if not nil, is the go.mod file the proxy must serve.
+	// Otherwise any go.mod file declaring the module path will do.
+	GoMod []byte
+}
+
+// A Failure is a check that the proxy under test did not pass.
+type Failure struct {
+	Check  string         // "list", "latest", "info", "mod", "zip", "escape", "not-found" or "gone"
+	Module module.Version // module version checked; Version is "" for module-wide checks
+	URL    string         // URL that was requested
+	Err    error          // what was wrong
+}
+
+func (f *Failure) Error() string {
+	m := f.Module.Path
+	if f.Module.Version != "" {
+		m += "@" + f.Module.Version
+	}
+	return fmt.Sprintf("%s %s: GET %s: %v", f.Check, m, f.URL, f.Err)
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// A Report is the outcome of a Check.
+type Report struct {
+	Checks   int        // number of checks run
+	Failures []*Failure // checks that failed
+}
+
+// Err returns nil if every check passed, or an error joining the
+// Failures otherwise.
+func (r *Report) Err() error {
+	errs := make([]error, len(r.Failures))
+	for i, f := range r.Failures {
+		errs[i] = f
+	}
+	return errors.Join(errs...)
+}
+
+// Check checks the proxy at baseURL, an entry of a GOPROXY list such as
+// "https://proxy.golang.org", against want, sending requests with client,
+// or http.DefaultClient if client is nil. Only a canceled ctx makes it
+// stop early; every other problem is a Failure in the Report.
+func Check(ctx context.Context, client *http.Client, baseURL string, want *Want) *Report {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := &checker{
+		ctx:    ctx,
+		client: client,
+		base:   strings.TrimSuffix(baseURL, "/"),
+		report: &Report{},
+	}
+	c.run(want)
+	return c.report
+}
+
+// CheckHandler checks the proxy served by h, such as a proxy.Server,
+// against want, without listening on a network.
+func CheckHandler(ctx context.Context, h http.Handler, want *Want) *Report {
+	client := &http.Client{Transport: handlerTransport{h}}
+	return Check(ctx, client, "http://proxytest.invalid", want)
+}
+
+// handlerTransport is a RoundTripper that serves requests with an
+// http.Handler.
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	defer func() {
+		// A handler aborts a response by panicking with
+		// http.ErrAbortHandler, which a client sees as a broken
+		// connection.
+		if v := recover(); v != nil {
+			if v != http.ErrAbortHandler {
+				panic(v)
+			}
+			resp, err = nil, errors.New("proxytest: handler aborted response")
+		}
+	}()
+	rec := httptest.NewRecorder()
+	t.h.ServeHTTP(rec, req)
+	resp = rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+type checker struct {
+	ctx    context.Context
+	client *http.Client
+	base   string
+	report *Report
+}
+
+// fail records a failure of the check of m at url.
+func (c *checker) fail(check string, m module.Version, url string, format string, args ...any) {
+	c.report.Failures = append(c.report.Failures, &Failure{
+		Check:  check,
+		Module: m,
+		URL:    url,
+		Err:    fmt.Errorf(format, args...),
+	})
+}
+
+func (c *checker) run(want *Want) {
+	var paths []string
+	listed := map[string][]string{}
+	for _, m := range want.Modules {
+		if !slices.Contains(paths, m.Mod.Path) {
+			paths = append(paths, m.Mod.Path)
+		}
+		if !module.IsPseudoVersion(m.Mod.Version) {
+			listed[m.Mod.Path] = append(listed[m.Mod.Path], m.Mod.Version)
+		}
+	}
+	for p := range want.Latest {
+		if !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+
+	for _, p := range paths {
+		if c.ctx.Err() != nil {
+			return
+		}
+		c.checkList(p, listed[p])
+		c.checkLatest(p, want.Latest[p])
+		c.checkEscape(p)
+	}
+	for _, m := range want.Modules {
+		if c.ctx.Err() != nil {
+			return
+		}
+		c.checkInfo(m.Mod)
+		c.checkMod(m)
+		c.checkZip(m.Mod)
+	}
+	for _, m := range want.NotFound {
+		if c.ctx.Err() != nil {
+			return
+		}
+		c.checkMissing("not-found", m, http.StatusNotFound, http.StatusGone)
+	}
+	for _, m := range want.Gone {
+		if c.ctx.Err() != nil {
+			return
+		}
+		c.checkMissing("gone", m, http.StatusGone)
+	}
+}
+
+// url returns the URL of a file of the module path, escaping the path.
+func (c *checker) url(path, file string) (string, error) {
+	epath, err := module.EscapePath(path)
+	if err != nil {
+		return "", err
+	}
+	return c.base + "/" + epath + "/" + file, nil
+}
+
+// versionURL returns the URL of the file of m with the given extension,
+// escaping the path and version.
+func (c *checker) versionURL(m module.Version, ext string) (string, error) {
+	eversion, err := module.EscapeVersion(m.Version)
+	if err != nil {
+		return "", err
+	}
+	return c.url(m.Path, "@v/"+eversion+ext)
+}
+
+// get fetches url, checking that the response is 200 OK with the given
+// media type. It reports the first problem as a failure of check and
+// returns nil.
+func (c *checker) get(check string, m module.Version, url, mediaType string) []byte {
+	c.report.Checks++
+	resp, body, err := c.do(url)
+	if err != nil {
+		c.fail(check, m, url, "%v", err)
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		c.fail(check, m, url, "status %s, want 200 OK\n\t%s", resp.Status, bytes.TrimSpace(body))
+		return nil
+	}
+	ct := resp.Header.Get("Content-Type")
+	if mt, _, err := mime.ParseMediaType(ct); err != nil || mt != mediaType {
+		c.fail(check, m, url, "Content-Type %q, want %q", ct, mediaType)
+		return nil
+	}
+	return body
+}
+
+func (c *checker) do(url string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(c.ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+// checkList checks that the list of the module path holds valid,
+// canonical versions other than pseudo-versions, including want.
+func (c *checker) checkList(path string, want []string) {
+	m := module.Version{Path: path}
+	url, err := c.url(path, "@v/list")
+	if err != nil {
+		c.fail("list", m, url, "%v", err)
+		return
+	}
+	body := c.get("list", m, url, "text/plain")
+	if body == nil {
+		return
+	}
+	var versions []string
+	for _, line := range strings.Split(string(body), "\n") {
+		v := strings.TrimSpace(line)
+		if v == "" {
+			continue
+		}
+		if err := module.Check(path, v); err != nil {
+			c.fail("list", m, url, "invalid version: %v", err)
+			return
+		}
+		if semver.Canonical(v) != strings.TrimSuffix(v, "+incompatible") {
+			c.fail("list", m, url, "non-canonical version %s", v)
+			return
+		}
+		if module.IsPseudoVersion(v) {
+			c.fail("list", m, url, "pseudo-version %s is listed", v)
+			return
+		}
+		versions = append(versions, v)
+	}
+	for _, v := range want {
+		if !slices.Contains(versions, v) {
+			c.fail("list", m, url, "version %s is not listed; got %q", v, versions)
+			return
+		}
+	}
+}
+
+// checkLatest checks that @latest of the module path reports a valid
+// version, which is want if want is not "".
+func (c *checker) checkLatest(path, want string) {
+	m := module.Version{Path: path}
+	url, err := c.url(path, "@latest")
+	if err != nil {
+		c.fail("latest", m, url, "%v", err)
+		return
+	}
+	ri, ok := c.decodeInfo("latest", m, url)
+	if !ok {
+		return
+	}
+	if err := module.Check(path, ri.Version); err != nil {
+		c.fail("latest", m, url, "invalid version: %v", err)
+		return
+	}
+	if want != "" && ri.Version != want {
+		c.fail("latest", m, url, "version %s, want %s", ri.Version, want)
+	}
+}
+
+// checkEscape checks that the module path is not served unescaped, if
+// escaping changes it.
+func (c *checker) checkEscape(path string) {
+	epath, err := module.EscapePath(path)
+	if err != nil || epath == path {
+		return
+	}
+	c.report.Checks++
+	m := module.Version{Path: path}
+	url := c.base + "/" + path + "/@v/list"
+	resp, _, err := c.do(url)
+	if err != nil {
+		c.fail("escape", m, url, "%v", err)
+		return
+	}
+	if resp.StatusCode == http.StatusOK {
+		c.fail("escape", m, url, "unescaped path served with status %s", resp.Status)
+	}
+}
+
+func (c *checker) decodeInfo(check string, m module.Version, url string) (*proxy.RevInfo, bool) {
+	body := c.get(check, m, url, "application/json")
+	if body == nil {
+		return nil, false
+	}
+	var ri proxy.RevInfo
+	if err := json.Unmarshal(body, &ri); err != nil {
+		c.fail(check, m, url, "decoding info: %v", err)
+		return nil, false
+	}
+	return &ri, true
+}
+
+// checkInfo checks that the .info file of m reports its version.
+func (c *checker) checkInfo(m module.Version) {
+	url, err := c.versionURL(m, ".info")
+	if err != nil {
+		c.fail("info", m, url, "%v", err)
+		return
+	}
+	ri, ok := c.decodeInfo("info", m, url)
+	if !ok {
+		return
+	}
+	if ri.Version != m.Version {
+		c.fail("info", m, url, "version %s, want %s", ri.Version, m.Version)
+	}
+}
+
+// checkMod checks that the .mod file of m.Mod declares its path, and is
+// m.GoMod if that is not nil.
+func (c *checker) checkMod(mod Module) {
+	m := mod.Mod
+	url, err := c.versionURL(m, ".mod")
+	if err != nil {
+		c.fail("mod", m, url, "%v", err)
+		return
+	}
+	body := c.get("mod", m, url, "text/plain")
+	if body == nil {
+		return
+	}
+	if mod.GoMod != nil && !bytes.Equal(body, mod.GoMod) {
+		c.fail("mod", m, url, "go.mod is\n%s\nwant\n%s", body, mod.GoMod)
+		return
+	}
+	f, err := modfile.ParseLax("go.mod", body, nil)
+	if err != nil {
+		c.fail("mod", m, url, "%v", err)
+		return
+	}
+	if f.Module == nil || f.Module.Mod.Path != m.Path {
+		c.fail("mod", m, url, "go.mod does not declare module %s", m.Path)
+	}
+}
+
+// checkZip checks that the .zip file of m passes the checks of
+// golang.org/x/mod/zip.CheckZip.
+func (c *checker) checkZip(m module.Version) {
+	url, err := c.versionURL(m, ".zip")
+	if err != nil {
+		c.fail("zip", m, url, "%v", err)
+		return
+	}
+	body := c.get("zip", m, url, "application/zip")
+	if body == nil {
+		return
+	}
+	// CheckZip wants a file name.
+	f, err := os.CreateTemp("", "proxytest-*.zip")
+	if err != nil {
+		c.fail("zip", m, url, "%v", err)
+		return
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		c.fail("zip", m, url, "%v", err)
+		return
+	}
+	cf, err := modzip.CheckZip(m, f.Name())
+	if err == nil {
+		err = cf.Err()
+	}
+	if err != nil {
+		c.fail("zip", m, url, "%v", err)
+	}
+}
+
+// checkMissing checks that the .info file of m, or the list of m.Path if
+// m.Version is "", is answered with one of the given statuses.
+func (c *checker) checkMissing(check string, m module.Version, statuses ...int) {
+	var url string
+	var err error
+	if m.Version == "" {
+		url, err = c.url(m.Path, "@v/list")
+	} else {
+		url, err = c.versionURL(m, ".info")
+	}
+	if err != nil {
+		c.fail(check, m, url, "%v", err)
+		return
+	}
+	c.report.Checks++
+	resp, _, err := c.do(url)
+	if err != nil {
+		c.fail(check, m, url, "%v", err)
+		return
+	}
+	if !slices.Contains(statuses, resp.StatusCode) {
+		want := make([]string, len(statuses))
+		for i, s := range statuses {
+			want[i] = fmt.Sprintf("%d %s", s, http.StatusText(s))
+		}
+		c.fail(check, m, url, "status %s, want %s", resp.Status, strings.Join(want, " or "))
+	}
+}
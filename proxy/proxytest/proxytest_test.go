@@ -0,0 +1,215 @@
+package proxytest_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jcbhmr/xmod/proxy"
+	"github.com/jcbhmr/xmod/proxy/proxytest"
+	xzip "github.com/jcbhmr/xmod/zip"
+	"golang.org/x/mod/module"
+)
+
+// memServerOps serves modules from memory. Versions in gone are
+// answered with proxy.ErrGone.
+type memServerOps struct {
+	versions map[string][]string
+	gomods   map[module.Version][]byte
+	zips     map[module.Version][]byte
+	gone     map[module.Version]bool
+}
+
+func (o *memServerOps) Versions(ctx context.Context, path string) ([]string, error) {
+	versions, ok := o.versions[path]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return versions, nil
+}
+
+func (o *memServerOps) Stat(ctx context.Context, m module.Version) (*proxy.RevInfo, error) {
+	if o.gone[m] {
+		return nil, proxy.ErrGone
+	}
+	if _, ok := o.gomods[m]; !ok {
+		return nil, fs.ErrNotExist
+	}
+	return &proxy.RevInfo{Version: m.Version}, nil
+}
+
+func (o *memServerOps) GoMod(ctx context.Context, m module.Version) ([]byte, error) {
+	if o.gone[m] {
+		return nil, proxy.ErrGone
+	}
+	data, ok := o.gomods[m]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return data, nil
+}
+
+func (o *memServerOps) Zip(ctx context.Context, dst io.Writer, m module.Version) error {
+	if o.gone[m] {
+		return proxy.ErrGone
+	}
+	data, ok := o.zips[m]
+	if !ok {
+		return fs.ErrNotExist
+	}
+	_, err := dst.Write(data)
+	return err
+}
+
+// newFixture returns ServerOps serving a module whose path needs case
+// escaping, at a release, a +incompatible and a pseudo-version, and the
+// Want that a proxy.Server for it meets.
+func newFixture(t *testing.T) (*memServerOps, *proxytest.Want) {
+	t.Helper()
+	const path = "example.org/Awesome"
+	ops := &memServerOps{
+		versions: map[string][]string{path: {"v1.0.0", "v2.0.0+incompatible"}},
+		gomods:   map[module.Version][]byte{},
+		zips:     map[module.Version][]byte{},
+		gone:     map[module.Version]bool{{Path: path, Version: "v0.9.0"}: true},
+	}
+	want := &proxytest.Want{
+		Latest:   map[string]string{},
+		NotFound: []module.Version{{Path: path, Version: "v3.0.0"}, {Path: "example.org/missing"}},
+		Gone:     []module.Version{{Path: path, Version: "v0.9.0"}},
+	}
+	for _, v := range []string{"v1.0.0", "v2.0.0+incompatible", "v0.0.0-20240101000000-abcdefabcdef"} {
+		m := module.Version{Path: path, Version: v}
+		gomod := []byte("module " + path + "\n")
+		files := fstest.MapFS{
+			"awesome.go": {Data: []byte("package awesome\n")},
+		}
+		// A +incompatible version has no go.mod file of its own.
+		if !strings.HasSuffix(v, "+incompatible") {
+			files["go.mod"] = &fstest.MapFile{Data: gomod}
+		}
+		var buf bytes.Buffer
+		if err := xzip.CreateFromFS(files, &buf, m, "."); err != nil {
+			t.Fatal(err)
+		}
+		ops.gomods[m] = gomod
+		ops.zips[m] = buf.Bytes()
+		want.Modules = append(want.Modules, proxytest.Module{Mod: m, GoMod: gomod})
+	}
+	// Without a Latest method the server reports the highest version.
+	want.Latest[path] = "v2.0.0+incompatible"
+	return ops, want
+}
+
+func TestCheckHandler(t *testing.T) {
+	ops, want := newFixture(t)
+	report := proxytest.CheckHandler(context.Background(), proxy.NewServer(ops), want)
+	if err := report.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if report.Checks == 0 {
+		t.Fatal("no checks run")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ops, want := newFixture(t)
+	server := httptest.NewServer(proxy.NewServer(ops))
+	defer server.Close()
+	report := proxytest.Check(context.Background(), server.Client(), server.URL+"/", want)
+	if err := report.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckHandler_Failures(t *testing.T) {
+	tests := []struct {
+		name   string
+		wrap   func(ops *memServerOps, want *proxytest.Want, next http.Handler) http.Handler
+		checks []string
+	}{
+		{
+			name: "empty list",
+			wrap: func(ops *memServerOps, want *proxytest.Want, next http.Handler) http.Handler {
+				ops.versions["example.org/Awesome"] = []string{}
+				want.Latest = nil
+				return next
+			},
+			checks: []string{"latest", "list"},
+		},
+		{
+			name: "pseudo-version listed",
+			wrap: func(ops *memServerOps, want *proxytest.Want, next http.Handler) http.Handler {
+				ops.versions["example.org/Awesome"] = append(ops.versions["example.org/Awesome"], "v0.0.0-20240101000000-abcdefabcdef")
+				return next
+			},
+			checks: []string{"list"},
+		},
+		{
+			name: "404 instead of 410",
+			wrap: func(ops *memServerOps, want *proxytest.Want, next http.Handler) http.Handler {
+				ops.gone = nil
+				return next
+			},
+			checks: []string{"gone"},
+		},
+		{
+			name: "wrong content type",
+			wrap: func(ops *memServerOps, want *proxytest.Want, next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if strings.HasSuffix(r.URL.Path, ".mod") {
+						w.Header().Set("Content-Type", "application/octet-stream")
+						w.Write(ops.gomods[want.Modules[0].Mod])
+						return
+					}
+					next.ServeHTTP(w, r)
+				})
+			},
+			checks: []string{"mod", "mod", "mod"},
+		},
+		{
+			name: "invalid zip",
+			wrap: func(ops *memServerOps, want *proxytest.Want, next http.Handler) http.Handler {
+				ops.zips[want.Modules[0].Mod] = []byte("not a zip")
+				return next
+			},
+			checks: []string{"zip"},
+		},
+		{
+			name: "unescaped path",
+			wrap: func(ops *memServerOps, want *proxytest.Want, next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					r.URL.Path = strings.ReplaceAll(r.URL.Path, "/Awesome/", "/!awesome/")
+					r.URL.RawPath = ""
+					next.ServeHTTP(w, r)
+				})
+			},
+			checks: []string{"escape"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, want := newFixture(t)
+			h := tt.wrap(ops, want, proxy.NewServer(ops))
+			report := proxytest.CheckHandler(context.Background(), h, want)
+			var checks []string
+			for _, f := range report.Failures {
+				checks = append(checks, f.Check)
+				if f.URL == "" || f.Module.Path == "" || f.Err == nil {
+					t.Errorf("incomplete failure %+v", f)
+				}
+			}
+			slices.Sort(checks)
+			if !slices.Equal(checks, tt.checks) {
+				t.Fatalf("failed checks %q, want %q\n%v", checks, tt.checks, report.Err())
+			}
+		})
+	}
+}
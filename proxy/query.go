@@ -0,0 +1,329 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// A NoMatchingVersionError reports a query that no version satisfies.
+// It matches fs.ErrNotExist.
+type NoMatchingVersionError struct {
+	Query, Current string
+}
+
+func (e *NoMatchingVersionError) Error() string {
+	currentSuffix := ""
+	if (e.Query == "upgrade" || e.Query == "patch") && e.Current != "" && e.Current != "none" {
+		currentSuffix = fmt.Sprintf(" (current version is %s)", e.Current)
+	}
+	return fmt.Sprintf("no matching versions for query %q", e.Query) + currentSuffix
+}
+
+func (e *NoMatchingVersionError) Is(target error) bool {
+	return target == fs.ErrNotExist
+}
+
+// Query resolves a version query the way 'go get' does.
+//
+// The query may be "latest", "upgrade", "patch", a comparison such as
+// "<v1.5" or ">=v1.2.3", a version or version prefix such as "v1.2", or a
+// revision identifier, which is passed to the proxy's .info endpoint.
+// Prereleases are only chosen when no release matches. current is the
+// version in use, or "" or "none" if there is none; "upgrade" and "patch"
+// never resolve to a version lower than current. If the Client excludes
+// retracted versions, only an exact version query or current may resolve
+// to one.
+//
+// https://go.dev/ref/mod#version-queries
+func (r *Repo) Query(query, current string) (*RevInfo, error) {
+	return r.QueryContext(context.Background(), query, current)
+}
+
+func (r *Repo) QueryContext(ctx context.Context, query, current string) (*RevInfo, error) {
+	return r.query(ctx, query, current, r.c.excludeRetracted.Load())
+}
+
+func (r *Repo) query(ctx context.Context, query, current string, excludeRetracted bool) (*RevInfo, error) {
+	// This mirrors queryProxy in cmd/go/internal/modload.
+	qm, err := r.newQueryMatcher(query, current)
+	if err != nil {
+		return nil, err
+	}
+
+	if qm.canStat {
+		// Special case for a query that can be resolved by a single Stat
+		// call: an exact version or a revision.
+		return r.StatContext(ctx, query)
+	}
+
+	if excludeRetracted {
+		qm.retractions, err = r.RetractionsContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	versions, err := r.versions(ctx, qm.prefix)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	semver.Sort(versions)
+	releases, prereleases, err := r.filterVersions(ctx, qm, versions)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := func(v string) (*RevInfo, error) {
+		rev, err := r.StatContext(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		if (query == "upgrade" || query == "patch") && module.IsPseudoVersion(current) && !rev.Time.IsZero() {
+			// Don't allow "upgrade" or "patch" to move from a pseudo-version
+			// to a chronologically older version or pseudo-version.
+			currentTime, err := module.PseudoVersionTime(current)
+			if err == nil && rev.Time.Before(currentTime) {
+				return r.StatContext(ctx, current)
+			}
+		}
+		return rev, nil
+	}
+
+	if qm.preferLower {
+		if len(releases) > 0 {
+			return lookup(releases[0])
+		}
+		if len(prereleases) > 0 {
+			return lookup(prereleases[0])
+		}
+	} else {
+		if len(releases) > 0 {
+			return lookup(releases[len(releases)-1])
+		}
+		if len(prereleases) > 0 {
+			return lookup(prereleases[len(prereleases)-1])
+		}
+	}
+
+	if qm.mayUseLatest {
+		latest, err := r.latest(ctx)
+		if err == nil {
+			if qm.allowsVersion(latest.Version) {
+				return lookup(latest.Version)
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if (query == "upgrade" || query == "patch") && current != "" && current != "none" {
+		// "upgrade" and "patch" may stay on the current version if allowed.
+		return lookup(current)
+	}
+
+	return nil, &NoMatchingVersionError{Query: query, Current: current}
+}
+
+// A queryMatcher decides which versions satisfy a query.
+type queryMatcher struct {
+	prefix             string
+	filter             func(version string) bool
+	preferLower        bool
+	preferIncompatible bool
+	mayUseLatest       bool
+	canStat            bool
+	retractions        []Retraction
+}
+
+func (r *Repo) newQueryMatcher(query, current string) (*queryMatcher, error) {
+	badVersion := func(v string) (*queryMatcher, error) {
+		return nil, fmt.Errorf("invalid semantic version %q in range %q", v, query)
+	}
+	matchesMajor := func(v string) bool {
+		_, pathMajor, ok := module.SplitPathVersion(r.path)
+		if !ok {
+			return false
+		}
+		return module.CheckPathMajor(v, pathMajor) == nil
+	}
+
+	qm := &queryMatcher{}
+	switch {
+	case query == "latest":
+		qm.mayUseLatest = true
+
+	case query == "upgrade":
+		if current == "" || current == "none" {
+			qm.mayUseLatest = true
+		} else {
+			qm.mayUseLatest = module.IsPseudoVersion(current)
+			qm.filter = func(mv string) bool { return semver.Compare(mv, current) >= 0 }
+		}
+
+	case query == "patch":
+		if current == "" || current == "none" {
+			return nil, fmt.Errorf("can't query version %q of module %s: no existing version is required", query, r.path)
+		}
+		qm.mayUseLatest = module.IsPseudoVersion(current)
+		qm.prefix = semver.MajorMinor(current) + "."
+		qm.filter = func(mv string) bool { return semver.Compare(mv, current) >= 0 }
+
+	case strings.HasPrefix(query, "<="):
+		v := query[len("<="):]
+		if !semver.IsValid(v) {
+			return badVersion(v)
+		}
+		if isSemverPrefix(v) {
+			// Refuse to say whether <=v1.2 allows v1.2.3 (remember, @v1.2 might mean v1.2.3).
+			return nil, fmt.Errorf("ambiguous semantic version %q in range %q", v, query)
+		}
+		qm.filter = func(mv string) bool { return semver.Compare(mv, v) <= 0 }
+		if !matchesMajor(v) {
+			qm.preferIncompatible = true
+		}
+
+	case strings.HasPrefix(query, "<"):
+		v := query[len("<"):]
+		if !semver.IsValid(v) {
+			return badVersion(v)
+		}
+		qm.filter = func(mv string) bool { return semver.Compare(mv, v) < 0 }
+		if !matchesMajor(v) {
+			qm.preferIncompatible = true
+		}
+
+	case strings.HasPrefix(query, ">="):
+		v := query[len(">="):]
+		if !semver.IsValid(v) {
+			return badVersion(v)
+		}
+		qm.filter = func(mv string) bool { return semver.Compare(mv, v) >= 0 }
+		qm.preferLower = true
+		if !matchesMajor(v) {
+			qm.preferIncompatible = true
+		}
+
+	case strings.HasPrefix(query, ">"):
+		v := query[len(">"):]
+		if !semver.IsValid(v) {
+			return badVersion(v)
+		}
+		if isSemverPrefix(v) {
+			// Refuse to say whether >v1.2 allows v1.2.3 (remember, @v1.2 might mean v1.2.3).
+			return nil, fmt.Errorf("ambiguous semantic version %q in range %q", v, query)
+		}
+		qm.filter = func(mv string) bool { return semver.Compare(mv, v) > 0 }
+		qm.preferLower = true
+		if !matchesMajor(v) {
+			qm.preferIncompatible = true
+		}
+
+	case semver.IsValid(query):
+		if isSemverPrefix(query) {
+			qm.prefix = query + "."
+			// Do not allow the query "v1.2" to match versions lower than "v1.2.0",
+			// such as prereleases for that version. (https://golang.org/issue/31972)
+			qm.filter = func(mv string) bool { return semver.Compare(mv, query) >= 0 }
+		} else {
+			qm.canStat = true
+		}
+		if !matchesMajor(query) {
+			qm.preferIncompatible = true
+		}
+
+	default:
+		// A revision identifier, such as a branch name or commit hash.
+		qm.canStat = true
+	}
+	return qm, nil
+}
+
+func (qm *queryMatcher) allowsVersion(v string) bool {
+	if qm.prefix != "" && !strings.HasPrefix(v, qm.prefix) {
+		return false
+	}
+	if qm.filter != nil && !qm.filter(v) {
+		return false
+	}
+	if isRetracted(qm.retractions, v) {
+		return false
+	}
+	return true
+}
+
+// filterVersions splits the sorted versions that qm allows into releases
+// and prereleases. Versions with +incompatible are dropped once a lower
+// compatible version has a real go.mod file, as in the go command.
+func (r *Repo) filterVersions(ctx context.Context, qm *queryMatcher, versions []string) (releases, prereleases []string, err error) {
+	needIncompatible := qm.preferIncompatible
+
+	var lastCompatible string
+	for _, v := range versions {
+		if !qm.allowsVersion(v) {
+			continue
+		}
+
+		if !needIncompatible {
+			if !strings.HasSuffix(v, "+incompatible") {
+				lastCompatible = v
+			} else if lastCompatible != "" {
+				// If the latest compatible version has a go.mod file, ignore
+				// any version with a higher (+incompatible) major version.
+				// (See https://golang.org/issue/34165.)
+				ok, err := r.versionHasGoMod(ctx, lastCompatible)
+				if err != nil {
+					return nil, nil, err
+				}
+				if ok {
+					break
+				}
+				needIncompatible = true
+			}
+		}
+
+		if semver.Prerelease(v) != "" {
+			prereleases = append(prereleases, v)
+		} else {
+			releases = append(releases, v)
+		}
+	}
+	return releases, prereleases, nil
+}
+
+// versionHasGoMod reports whether the version has a real go.mod file,
+// rather than the one a proxy synthesizes for modules without one.
+func (r *Repo) versionHasGoMod(ctx context.Context, version string) (bool, error) {
+	data, err := r.GoModContext(ctx, version)
+	if err != nil {
+		return false, err
+	}
+	legacy := []byte(fmt.Sprintf("module %s\n", modfile.AutoQuote(r.path)))
+	return !bytes.Equal(data, legacy), nil
+}
+
+// isSemverPrefix reports whether v is a semantic version prefix: v1 or
+// v1.2 (not v1.2.3). The caller is assumed to have checked that
+// semver.IsValid(v) is true.
+func isSemverPrefix(v string) bool {
+	dots := 0
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '-', '+':
+			return false
+		case '.':
+			dots++
+			if dots >= 2 {
+				return false
+			}
+		}
+	}
+	return true
+}
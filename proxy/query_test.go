@@ -0,0 +1,115 @@
+package proxy_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/jcbhmr/xmod/proxy"
+)
+
+// newStaticRepo returns a Repo for path whose proxy knows the given
+// versions, each with a real go.mod file unless listed in noGoMod.
+func newStaticRepo(t *testing.T, path string, versions []string, noGoMod ...string) *proxy.Repo {
+	t.Helper()
+	ops := &countingClientOps{files: map[string][]byte{}}
+	list := ""
+	for _, v := range versions {
+		list += v + "\n"
+		ops.files["/"+path+"/@v/"+v+".info"] = []byte(fmt.Sprintf(`{"Version":%q}`, v))
+		ops.files["/"+path+"/@v/"+v+".mod"] = []byte("module " + path + "\n\ngo 1.21\n")
+	}
+	for _, v := range noGoMod {
+		ops.files["/"+path+"/@v/"+v+".mod"] = []byte("module " + path + "\n")
+	}
+	ops.files["/"+path+"/@v/list"] = []byte(list)
+	ops.files["/"+path+"/@v/master.info"] = []byte(`{"Version":"v1.9.1-0.20250101000000-abcdefabcdef","Time":"2025-01-01T00:00:00Z"}`)
+	repo, err := proxy.NewClient(ops).Lookup(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestRepo_Query(t *testing.T) {
+	repo := newStaticRepo(t, "example.org/awesome", []string{
+		"v1.0.0", "v1.1.0", "v1.2.0", "v1.2.1", "v1.2.2-pre", "v1.3.0-rc.1", "v1.4.0", "v1.5.0", "v1.6.0-beta",
+	})
+	tests := []struct {
+		query, current, want string
+	}{
+		{"latest", "", "v1.5.0"},
+		{"upgrade", "", "v1.5.0"},
+		{"upgrade", "v1.2.0", "v1.5.0"},
+		{"upgrade", "v1.6.0-beta", "v1.6.0-beta"},
+		{"patch", "v1.2.0", "v1.2.1"},
+		{"patch", "v1.3.0-rc.1", "v1.3.0-rc.1"},
+		{"<v1.5", "", "v1.4.0"},
+		{"<=v1.2.1", "", "v1.2.1"},
+		{">v1.2.0", "", "v1.2.1"},
+		{">=v1.4.0", "", "v1.4.0"},
+		{">v1.5.0", "", "v1.6.0-beta"},
+		{"v1", "", "v1.5.0"},
+		{"v1.2", "", "v1.2.1"},
+		{"v1.1.0", "", "v1.1.0"},
+		{"master", "", "v1.9.1-0.20250101000000-abcdefabcdef"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query+"/"+tt.current, func(t *testing.T) {
+			ri, err := repo.Query(tt.query, tt.current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ri.Version != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, ri.Version)
+			}
+		})
+	}
+
+	// "v1.3" does not match v1.3.0-rc.1, which is lower than v1.3.0.
+	for _, query := range []string{">v1.2", "<=v1", "<vbogus", "v2", "v1.3"} {
+		_, err := repo.Query(query, "")
+		if err == nil {
+			t.Errorf("Query(%q): expected error", query)
+		}
+	}
+	_, err := repo.Query("v3", "")
+	var noMatch *proxy.NoMatchingVersionError
+	if !errors.As(err, &noMatch) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected *NoMatchingVersionError, got %v", err)
+	}
+	_, err = repo.Query("patch", "")
+	if err == nil {
+		t.Error(`Query("patch", ""): expected error`)
+	}
+}
+
+func TestRepo_QueryIncompatible(t *testing.T) {
+	versions := []string{"v1.0.0", "v2.0.0+incompatible"}
+
+	repo := newStaticRepo(t, "example.org/legacy", versions, "v1.0.0")
+	ri, err := repo.Query("latest", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ri.Version != "v2.0.0+incompatible" {
+		t.Fatalf("expected %s, got %s", "v2.0.0+incompatible", ri.Version)
+	}
+
+	repo = newStaticRepo(t, "example.org/modern", versions)
+	ri, err = repo.Query("latest", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ri.Version != "v1.0.0" {
+		t.Fatalf("expected %s, got %s", "v1.0.0", ri.Version)
+	}
+	ri, err = repo.Query("v2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ri.Version != "v2.0.0+incompatible" {
+		t.Fatalf("expected %s, got %s", "v2.0.0+incompatible", ri.Version)
+	}
+}
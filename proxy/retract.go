@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// A Retraction is a range of versions that a module author retracted
+// with a retract directive.
+//
+// https://go.dev/ref/mod#go-mod-file-retract
+type Retraction struct {
+	Low, High string // inclusive bounds; equal for a single version
+	Rationale string
+}
+
+// Retractions returns the versions retracted by the go.mod file of the
+// module's latest version, ignoring retractions when choosing it, as the
+// go command does.
+func (r *Repo) Retractions() ([]Retraction, error) {
+	return r.RetractionsContext(context.Background())
+}
+
+func (r *Repo) RetractionsContext(ctx context.Context) ([]Retraction, error) {
+	r.retractMu.Lock()
+	defer r.retractMu.Unlock()
+	if r.retractDone {
+		return r.retractions, nil
+	}
+
+	// This mirrors queryLatestVersionIgnoringRetractions and
+	// checkRetractions in cmd/go/internal/modload.
+	latest, err := r.query(ctx, "latest", "", false)
+	if errors.Is(err, fs.ErrNotExist) {
+		// No versions, so nothing retracted.
+		r.retractDone = true
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	data, err := r.GoModContext(ctx, latest.Version)
+	if err != nil {
+		return nil, err
+	}
+	f, err := modfile.ParseLax(r.path+"@"+latest.Version+"/go.mod", data, nil)
+	if err != nil {
+		return nil, err
+	}
+	var retractions []Retraction
+	for _, rf := range f.Retract {
+		retractions = append(retractions, Retraction{
+			Low:       rf.Low,
+			High:      rf.High,
+			Rationale: rf.Rationale,
+		})
+	}
+	r.retractions = retractions
+	r.retractDone = true
+	return retractions, nil
+}
+
+// isRetracted reports whether v falls within any of the retractions.
+func isRetracted(retractions []Retraction, v string) bool {
+	for _, rt := range retractions {
+		if semver.Compare(rt.Low, v) <= 0 && semver.Compare(v, rt.High) <= 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package proxy_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/jcbhmr/xmod/proxy"
+)
+
+func TestRepo_Retractions(t *testing.T) {
+	ops := &countingClientOps{files: map[string][]byte{}}
+	versions := []string{"v1.0.0", "v1.1.0", "v1.2.0", "v1.3.0", "v1.4.0"}
+	for _, v := range versions {
+		ops.files["/example.org/awesome/@v/"+v+".info"] = []byte(fmt.Sprintf(`{"Version":%q}`, v))
+		ops.files["/example.org/awesome/@v/"+v+".mod"] = []byte("module example.org/awesome\n")
+	}
+	ops.files["/example.org/awesome/@v/list"] = []byte("v1.0.0\nv1.1.0\nv1.2.0\nv1.3.0\nv1.4.0\n")
+	ops.files["/example.org/awesome/@latest"] = []byte(`{"Version":"v1.4.0"}`)
+	ops.files["/example.org/awesome/@v/v1.4.0.mod"] = []byte(`module example.org/awesome
+
+retract (
+	v1.4.0 // Published by mistake.
+	[v1.1.0, v1.2.0] // Broken build.
+)
+`)
+
+	client := proxy.NewClient(ops)
+	repo, err := client.Lookup("example.org/awesome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	retractions, err := repo.Retractions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []proxy.Retraction{
+		{Low: "v1.4.0", High: "v1.4.0", Rationale: "Published by mistake."},
+		{Low: "v1.1.0", High: "v1.2.0", Rationale: "Broken build."},
+	}
+	if !slices.Equal(retractions, want) {
+		t.Fatalf("expected %v, got %v", want, retractions)
+	}
+
+	latest, err := repo.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Version != "v1.4.0" {
+		t.Fatalf("expected %s without exclusion, got %s", "v1.4.0", latest.Version)
+	}
+
+	client.SetExcludeRetracted(true)
+	got, err := repo.Versions("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"v1.0.0", "v1.3.0"}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	latest, err = repo.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Version != "v1.3.0" {
+		t.Fatalf("expected %s, got %s", "v1.3.0", latest.Version)
+	}
+	ri, err := repo.Query("<v1.3.0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ri.Version != "v1.0.0" {
+		t.Fatalf("expected %s, got %s", "v1.0.0", ri.Version)
+	}
+	ri, err = repo.Query("upgrade", "v1.4.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ri.Version != "v1.4.0" {
+		t.Fatalf("expected upgrade to stay on %s, got %s", "v1.4.0", ri.Version)
+	}
+	ri, err = repo.Query("v1.2.0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ri.Version != "v1.2.0" {
+		t.Fatalf("expected exact query for %s, got %s", "v1.2.0", ri.Version)
+	}
+}
@@ -0,0 +1,248 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// A RetryPolicy says how often and how long RetryOps retries a failed
+// remote read.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, including the first.
+	MaxAttempts int
+
+	// InitialDelay is the delay before the first retry. Each later delay
+	// doubles, up to MaxDelay. A random jitter of up to half the delay is
+	// subtracted, so that many clients do not retry in step.
+	InitialDelay time.Duration
+
+	// MaxDelay bounds every delay, including one asked for by a
+	// Retry-After header.
+	MaxDelay time.Duration
+
+	// OnRetry, if not nil, is called before each retry with the remote
+	// path, the number of the attempt that failed, its error and the delay
+	// before the next attempt.
+	OnRetry func(path string, attempt int, err error, delay time.Duration)
+}
+
+// DefaultRetryPolicy is the RetryPolicy used by NewRetryOps when none is
+// given.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  4,
+	InitialDelay: 500 * time.Millisecond,
+	MaxDelay:     30 * time.Second,
+}
+
+// RetryOps is a ClientOps that retries the remote reads of another
+// ClientOps after transient failures: an *Error with status 429 or a 5xx
+// status, a network timeout, a reset or refused connection, a broken pipe,
+// or a response cut short. It never retries other errors, including 404
+// and 410 responses, those matching fs.ErrNotExist, and certificate, DNS
+// and URL errors, which another attempt would only repeat.
+//
+// Readers returned by OpenRemote resume after a transient failure
+// partway through the content by opening the path again and skipping
+// what was already read.
+//
+// Each retry is logged through the Log method of the wrapped ClientOps
+// and passed to the policy's OnRetry hook.
+type RetryOps struct {
+	ops    ClientOps
+	policy RetryPolicy
+}
+
+// NewRetryOps returns a RetryOps that retries the remote reads of ops
+// according to policy, or DefaultRetryPolicy if policy is nil.
+func NewRetryOps(ops ClientOps, policy *RetryPolicy) *RetryOps {
+	if policy == nil {
+		policy = &DefaultRetryPolicy
+	}
+	return &RetryOps{ops: ops, policy: *policy}
+}
+
+func (r *RetryOps) ReadRemote(path string) ([]byte, error) {
+	return r.ReadRemoteContext(context.Background(), path)
+}
+
+func (r *RetryOps) ReadRemoteContext(ctx context.Context, path string) ([]byte, error) {
+	var data []byte
+	err := r.retry(ctx, path, 1, func() error {
+		var err error
+		data, err = readRemote(ctx, r.ops, path)
+		return err
+	})
+	return data, err
+}
+
+func (r *RetryOps) OpenRemote(ctx context.Context, path string) (io.ReadCloser, error) {
+	rr := &retryReader{ctx: ctx, r: r, path: path}
+	err := r.retry(ctx, path, 1, rr.open)
+	if err != nil {
+		return nil, err
+	}
+	return rr, nil
+}
+
+func (r *RetryOps) Log(msg string) {
+	r.ops.Log(msg)
+}
+
+// retry calls f until it succeeds, fails with an error that is not
+// transient, or has been called for the last allowed attempt. The first
+// call is counted as attempt number first.
+func (r *RetryOps) retry(ctx context.Context, path string, first int, f func() error) error {
+	for attempt := first; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= r.policy.MaxAttempts || !isTransient(err) {
+			return err
+		}
+		err = r.wait(ctx, path, attempt, err)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// wait reports that the given attempt failed with err and sleeps until
+// the next attempt, or until ctx is done.
+func (r *RetryOps) wait(ctx context.Context, path string, attempt int, err error) error {
+	delay := r.delay(attempt, err)
+	r.ops.Log(fmt.Sprintf("%v; retrying in %v (attempt %d of %d)", err, delay.Round(time.Millisecond), attempt+1, r.policy.MaxAttempts))
+	if r.policy.OnRetry != nil {
+		r.policy.OnRetry(path, attempt, err, delay)
+	}
+	noteRetry(ctx)
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// delay returns how long to wait after the given failed attempt.
+func (r *RetryOps) delay(attempt int, err error) time.Duration {
+	var pe *Error
+	if errors.As(err, &pe) && pe.RetryAfter > 0 {
+		return min(pe.RetryAfter, r.policy.MaxDelay)
+	}
+	d := r.policy.InitialDelay
+	for i := 1; i < attempt && d < r.policy.MaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, r.policy.MaxDelay)
+	if d > 1 {
+		d -= rand.N(d / 2)
+	}
+	return d
+}
+
+// isTransient reports whether a remote read that failed with err may
+// succeed if tried again.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	var pe *Error
+	if errors.As(err, &pe) {
+		return pe.StatusCode == http.StatusTooManyRequests || pe.StatusCode >= 500 && pe.StatusCode != http.StatusNotImplemented
+	}
+	// Every error of an http.Client is a net.Error, through *url.Error,
+	// so only its Timeout method says anything.
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// retryReader reads a remote path, opening it again after a transient
+// failure and skipping the bytes it has already returned.
+type retryReader struct {
+	ctx     context.Context
+	r       *RetryOps
+	path    string
+	rc      io.ReadCloser
+	off     int64
+	attempt int
+	err     error
+}
+
+func (rr *retryReader) open() error {
+	rr.attempt++
+	var rc io.ReadCloser
+	if ops, ok := rr.r.ops.(ClientOpsOpenRemote); ok {
+		if err := rr.ctx.Err(); err != nil {
+			return err
+		}
+		var err error
+		rc, err = ops.OpenRemote(rr.ctx, rr.path)
+		if err != nil {
+			return err
+		}
+	} else {
+		data, err := readRemote(rr.ctx, rr.r.ops, rr.path)
+		if err != nil {
+			return err
+		}
+		rc = io.NopCloser(bytes.NewReader(data))
+	}
+	if rr.off > 0 {
+		_, err := io.CopyN(io.Discard, rc, rr.off)
+		if err != nil {
+			rc.Close()
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	rr.rc = rc
+	return nil
+}
+
+func (rr *retryReader) Read(p []byte) (int, error) {
+	if rr.err != nil {
+		return 0, rr.err
+	}
+	n, err := rr.rc.Read(p)
+	rr.off += int64(n)
+	if err == nil || err == io.EOF || rr.attempt >= rr.r.policy.MaxAttempts || !isTransient(err) {
+		return n, err
+	}
+	rr.rc.Close()
+	rr.rc = nil
+	err = rr.r.wait(rr.ctx, rr.path, rr.attempt, err)
+	if err == nil {
+		err = rr.r.retry(rr.ctx, rr.path, rr.attempt+1, rr.open)
+	}
+	if err != nil {
+		rr.err = err
+		if n > 0 {
+			err = nil
+		}
+	}
+	return n, err
+}
+
+func (rr *retryReader) Close() error {
+	if rr.rc == nil {
+		return nil
+	}
+	return rr.rc.Close()
+}
@@ -0,0 +1,266 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jcbhmr/xmod/proxy"
+)
+
+// flakyServer fails the first failures requests with status, and then
+// responds with body.
+func flakyServer(t *testing.T, failures int, status int, header http.Header, body string) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(requests.Add(1)) <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestRetryOps(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		status   int
+		requests int32
+		retries  int
+		ok       bool
+	}{
+		{name: "503 then ok", failures: 2, status: http.StatusServiceUnavailable, requests: 3, retries: 2, ok: true},
+		{name: "502 then ok", failures: 1, status: http.StatusBadGateway, requests: 2, retries: 1, ok: true},
+		{name: "429 then ok", failures: 1, status: http.StatusTooManyRequests, requests: 2, retries: 1, ok: true},
+		{name: "404", failures: 1, status: http.StatusNotFound, requests: 1},
+		{name: "410", failures: 1, status: http.StatusGone, requests: 1},
+		{name: "403", failures: 1, status: http.StatusForbidden, requests: 1},
+		{name: "too many 503", failures: 10, status: http.StatusServiceUnavailable, requests: 3, retries: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := flakyServer(t, tt.failures, tt.status, nil, "v1.0.0\n")
+			httpOps, err := proxy.NewHTTPOps(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			retries := 0
+			ops := proxy.NewRetryOps(httpOps, &proxy.RetryPolicy{
+				MaxAttempts:  3,
+				InitialDelay: time.Millisecond,
+				MaxDelay:     10 * time.Millisecond,
+				OnRetry: func(path string, attempt int, err error, delay time.Duration) {
+					retries++
+					if path != "/example.org/awesome/@v/list" {
+						t.Errorf("OnRetry: unexpected path %q", path)
+					}
+					if attempt != retries {
+						t.Errorf("OnRetry: attempt = %d, want %d", attempt, retries)
+					}
+				},
+			})
+			data, err := ops.ReadRemote("/example.org/awesome/@v/list")
+			if tt.ok {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != "v1.0.0\n" {
+					t.Fatalf("unexpected data %q", data)
+				}
+			} else {
+				var pe *proxy.Error
+				if !errors.As(err, &pe) || pe.StatusCode != tt.status {
+					t.Fatalf("expected *proxy.Error with status %d, got %v", tt.status, err)
+				}
+			}
+			if got := requests.Load(); got != tt.requests {
+				t.Errorf("server got %d requests, want %d", got, tt.requests)
+			}
+			if retries != tt.retries {
+				t.Errorf("OnRetry called %d times, want %d", retries, tt.retries)
+			}
+		})
+	}
+}
+
+func TestRetryOps_RetryAfter(t *testing.T) {
+	server, _ := flakyServer(t, 1, http.StatusServiceUnavailable, http.Header{"Retry-After": {"120"}}, "v1.0.0\n")
+	httpOps, err := proxy.NewHTTPOps(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var delays []time.Duration
+	ops := proxy.NewRetryOps(httpOps, &proxy.RetryPolicy{
+		MaxAttempts:  2,
+		InitialDelay: time.Millisecond,
+		MaxDelay:     20 * time.Millisecond,
+		OnRetry: func(path string, attempt int, err error, delay time.Duration) {
+			var pe *proxy.Error
+			if !errors.As(err, &pe) || pe.RetryAfter != 120*time.Second {
+				t.Errorf("expected *proxy.Error with RetryAfter 2m0s, got %v", err)
+			}
+			delays = append(delays, delay)
+		},
+	})
+	_, err = ops.ReadRemote("/example.org/awesome/@v/list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Retry-After asks for more than MaxDelay, so MaxDelay is used
+	// instead of a jittered backoff delay.
+	if len(delays) != 1 || delays[0] != 20*time.Millisecond {
+		t.Fatalf("unexpected delays %v", delays)
+	}
+}
+
+// resettingClientOps serves data, but the first reader it opens fails
+// with io.ErrUnexpectedEOF after half of it.
+type resettingClientOps struct {
+	data  []byte
+	opens int
+}
+
+func (r *resettingClientOps) ReadRemote(path string) ([]byte, error) {
+	return nil, fs.ErrNotExist
+}
+
+func (r *resettingClientOps) OpenRemote(ctx context.Context, path string) (io.ReadCloser, error) {
+	r.opens++
+	if r.opens == 1 {
+		return io.NopCloser(io.MultiReader(bytes.NewReader(r.data[:len(r.data)/2]), errReader{io.ErrUnexpectedEOF})), nil
+	}
+	return io.NopCloser(bytes.NewReader(r.data)), nil
+}
+
+func (r *resettingClientOps) Log(msg string) {}
+
+type errReader struct {
+	err error
+}
+
+func (e errReader) Read(p []byte) (int, error) {
+	return 0, e.err
+}
+
+func TestRetryOps_ResumeOpenRemote(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	inner := &resettingClientOps{data: data}
+	ops := proxy.NewRetryOps(inner, &proxy.RetryPolicy{MaxAttempts: 2, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	repo, err := proxy.NewClient(ops).Lookup("example.org/awesome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = repo.Zip(&buf, "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("got %d bytes, want the %d bytes served", buf.Len(), len(data))
+	}
+	if inner.opens != 2 {
+		t.Fatalf("opened %d times, want 2", inner.opens)
+	}
+}
+
+// errClientOps fails every read with err.
+type errClientOps struct {
+	err   error
+	reads int
+}
+
+func (e *errClientOps) ReadRemote(path string) ([]byte, error) {
+	e.reads++
+	return nil, e.err
+}
+
+func (e *errClientOps) Log(msg string) {}
+
+func TestRetryOps_NetworkErrors(t *testing.T) {
+	// httpErr wraps err the way an http.Client does.
+	httpErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://proxy.example.org/example.org/awesome/@v/list", Err: err}
+	}
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{name: "reset", err: httpErr(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), transient: true},
+		{name: "refused", err: httpErr(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), transient: true},
+		{name: "broken pipe", err: httpErr(&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}), transient: true},
+		{name: "timeout", err: httpErr(&net.DNSError{Err: "i/o timeout", Name: "proxy.example.org", IsTimeout: true}), transient: true},
+		{name: "unexpected EOF", err: httpErr(io.ErrUnexpectedEOF), transient: true},
+		{name: "no such host", err: httpErr(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "proxy.example.org", IsNotFound: true}})},
+		{name: "unknown authority", err: httpErr(x509.UnknownAuthorityError{})},
+		{name: "unsupported scheme", err: httpErr(errors.New(`unsupported protocol scheme "ftp"`))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &errClientOps{err: tt.err}
+			ops := proxy.NewRetryOps(inner, &proxy.RetryPolicy{
+				MaxAttempts:  3,
+				InitialDelay: time.Millisecond,
+				MaxDelay:     time.Millisecond,
+			})
+			_, err := ops.ReadRemote("/example.org/awesome/@v/list")
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			want := 1
+			if tt.transient {
+				want = 3
+			}
+			if inner.reads != want {
+				t.Errorf("%d reads, want %d", inner.reads, want)
+			}
+		})
+	}
+}
+
+func TestRetryOps_TLSError(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	httpOps, err := proxy.NewHTTPOps(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retries := 0
+	ops := proxy.NewRetryOps(httpOps, &proxy.RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: time.Millisecond,
+		MaxDelay:     time.Millisecond,
+		OnRetry: func(path string, attempt int, err error, delay time.Duration) {
+			retries++
+		},
+	})
+	// The default client does not trust the test server's certificate.
+	_, err = ops.ReadRemote("/example.org/awesome/@v/list")
+	if err == nil {
+		t.Fatal("expected a certificate error")
+	}
+	if retries != 0 {
+		t.Errorf("retried %d times after %v", retries, err)
+	}
+}
@@ -1,24 +1,30 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
-	"io/fs"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/mod/module"
 )
 
 type Server struct {
-	ops   ServerOps
-	mux   http.ServeMux
-	remux http.ServeMux
+	ops    ServerOps
+	mux    http.ServeMux
+	remux  http.ServeMux
+	logger atomic.Pointer[slog.Logger]
+	tracer atomic.Pointer[Tracer]
+	sumdb  atomic.Pointer[sumdbProxy]
 }
 
 type ServerOps interface {
@@ -33,8 +39,24 @@ type ServerOpsLatest interface {
 	Latest(ctx context.Context, path string) (*RevInfo, error)
 }
 
+// ServerOpsZipFile is implemented by ServerOps that can open the zip file
+// of a module version for random access. A Server then serves zip files
+// with http.ServeContent, which supports Range requests, so that clients
+// can resume downloads, and sends an *os.File with sendfile where the
+// platform has it.
+type ServerOpsZipFile interface {
+	ServerOps
+	// ZipFile opens the zip file of m and returns it with its
+	// modification time, which may be zero. The Server closes the
+	// returned file if it implements io.Closer.
+	ZipFile(ctx context.Context, m module.Version) (io.ReadSeeker, time.Time, error)
+}
+
 func NewServer(ops ServerOps) *Server {
 	s := &Server{ops: ops}
+	// No module path starts with "sumdb/", as its first element has no
+	// dot.
+	s.mux.HandleFunc("GET /sumdb/{rest...}", s.serveSumDB)
 	s.mux.HandleFunc("GET /{rest...}", func(w http.ResponseWriter, r *http.Request) {
 		rest := r.PathValue("rest")
 		var err error
@@ -53,11 +75,10 @@ func NewServer(ops ServerOps) *Server {
 		var newRoutePath string
 		if routePath == "/@v/list" {
 			newRoutePath = "/@v/list"
-			return
 		} else if strings.HasPrefix(routePath, "/@v/") {
 			ext := path.Ext(routePath)
 			if ext == ".info" || ext == ".mod" || ext == ".zip" {
-				newRoutePath = "/@v/" + strings.TrimSuffix(routePath, ext) + "/" + ext
+				newRoutePath = strings.TrimSuffix(routePath, ext) + "/" + ext
 			} else {
 				err = fmt.Errorf("unknown extension %q", ext)
 				http.Error(w, err.Error(), http.StatusBadRequest)
@@ -75,84 +96,276 @@ func NewServer(ops ServerOps) *Server {
 		s.remux.ServeHTTP(w, r)
 	})
 	s.remux.HandleFunc("GET /{path}/@v/list", func(w http.ResponseWriter, r *http.Request) {
-		versions, err := s.ops.Versions(r.Context(), r.URL.Path[1:])
-		if errors.Is(err, fs.ErrNotExist) {
-			http.Error(w, err.Error(), http.StatusNotFound)
+		path, _ := url.PathUnescape(r.PathValue("path"))
+		s.serveData(w, r, module.Version{Path: path}, "list", "text/plain; charset=utf-8", mutableCacheControl, func(ctx context.Context) ([]byte, error) {
+			versions, err := s.ops.Versions(ctx, path)
+			if err != nil {
+				return nil, err
+			}
+			var buf bytes.Buffer
+			for _, v := range versions {
+				fmt.Fprintln(&buf, v)
+			}
+			return buf.Bytes(), nil
+		})
+	})
+	s.remux.HandleFunc("GET /{path}/@v/{version}/.info", func(w http.ResponseWriter, r *http.Request) {
+		path, _ := url.PathUnescape(r.PathValue("path"))
+		version, err := versionValue(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
-		} else if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		m := module.Version{Path: path, Version: version}
+		cacheControl := versionCacheControl(version)
+		v, err := s.validator(r.Context(), m, "info")
+		if err != nil {
+			serveError(w, err)
 			return
 		}
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		for _, v := range versions {
-			fmt.Fprintln(w, v)
+		if notModified(w, r, cacheControl, v) {
+			return
 		}
-	})
-	s.remux.HandleFunc("GET /{path}/@v/{version}/.info", func(w http.ResponseWriter, r *http.Request) {
-		path, _ := url.PathUnescape(r.PathValue("path"))
-		version, _ := url.PathUnescape(r.PathValue("version"))
-		ri, err := s.ops.Stat(r.Context(), module.Version{Path: path, Version: version})
-		if errors.Is(err, fs.ErrNotExist) {
-			http.Error(w, err.Error(), http.StatusNotFound)
+		ri, err := s.ops.Stat(r.Context(), m)
+		if err != nil {
+			serveError(w, err)
 			return
-		} else if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		// A query such as a branch name resolves to a different version
+		// over time, even if it happens to look canonical.
+		if ri.Version != version {
+			cacheControl = mutableCacheControl
+		}
+		data, err := marshalInfo(ri, nil)
+		if err != nil {
+			serveError(w, err)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(ri)
+		serveBytes(w, r, "application/json", cacheControl, v, data)
 	})
 	s.remux.HandleFunc("GET /{path}/@v/{version}/.mod", func(w http.ResponseWriter, r *http.Request) {
 		path, _ := url.PathUnescape(r.PathValue("path"))
-		version, _ := url.PathUnescape(r.PathValue("version"))
-		data, err := s.ops.GoMod(r.Context(), module.Version{Path: path, Version: version})
-		if errors.Is(err, fs.ErrNotExist) {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		} else if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		version, err := versionValue(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		w.Write(data)
+		m := module.Version{Path: path, Version: version}
+		s.serveData(w, r, m, "mod", "text/plain; charset=utf-8", versionCacheControl(version), func(ctx context.Context) ([]byte, error) {
+			return s.ops.GoMod(ctx, m)
+		})
 	})
 	s.remux.HandleFunc("GET /{path}/@v/{version}/.zip", func(w http.ResponseWriter, r *http.Request) {
 		path, _ := url.PathUnescape(r.PathValue("path"))
-		version, _ := url.PathUnescape(r.PathValue("version"))
+		version, err := versionValue(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m := module.Version{Path: path, Version: version}
+		cacheControl := versionCacheControl(version)
+		v, err := s.validator(r.Context(), m, "zip")
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		if notModified(w, r, cacheControl, v) {
+			return
+		}
+		if ops, ok := s.ops.(ServerOpsZipFile); ok {
+			serveZipFile(w, r, ops, m, cacheControl, v)
+			return
+		}
 		w.Header().Set("Content-Type", "application/zip")
-		w.WriteHeader(http.StatusOK)
-		sw := &sizeWriter{W: w}
-		err := s.ops.Zip(r.Context(), sw, module.Version{Path: path, Version: version})
-		if sw.Size == 0 {
-			if errors.Is(err, fs.ErrNotExist) {
-				http.Error(w, err.Error(), http.StatusNotFound)
-				return
-			} else if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+		setCacheHeaders(w.Header(), cacheControl, v)
+		// Small zips are spooled, so that an error can still be reported
+		// with its own status. Once the 200 status is sent, an error
+		// aborts the response instead, so that the client does not take
+		// a truncated zip for a whole one.
+		sw := &spoolWriter{w: w}
+		err = s.ops.Zip(r.Context(), sw, m)
+		if err != nil {
+			if !sw.flushed {
+				serveError(w, err)
 				return
 			}
+			abortResponse(w, err)
+		}
+		if !sw.flushed {
+			w.Header().Set("Content-Length", strconv.Itoa(sw.buf.Len()))
+			sw.flush()
 		}
 	})
 	s.remux.HandleFunc("GET /{path}/@latest", func(w http.ResponseWriter, r *http.Request) {
 		path, _ := url.PathUnescape(r.PathValue("path"))
-		ri, err := s.ops.(ServerOpsLatest).Latest(r.Context(), path)
-		if errors.Is(err, fs.ErrNotExist) {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		} else if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(ri)
+		s.serveData(w, r, module.Version{Path: path}, "latest", "application/json", mutableCacheControl, func(ctx context.Context) ([]byte, error) {
+			return marshalInfo(s.latest(ctx, path))
+		})
 	})
 	return s
 }
 
+// serveData responds with the file of m that get returns, answering
+// conditional requests and setting the caching headers. The ETag comes
+// from the ServerOpsValidator if any, or else from the content itself.
+func (s *Server) serveData(w http.ResponseWriter, r *http.Request, m module.Version, file, contentType, cacheControl string, get func(ctx context.Context) ([]byte, error)) {
+	v, err := s.validator(r.Context(), m, file)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	if notModified(w, r, cacheControl, v) {
+		return
+	}
+	data, err := get(r.Context())
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	serveBytes(w, r, contentType, cacheControl, v, data)
+}
+
+// serveBytes responds with data, or with 304 Not Modified if a
+// conditional request matches it. The ETag comes from v, or if it has no
+// Hash, from data.
+func serveBytes(w http.ResponseWriter, r *http.Request, contentType, cacheControl string, v *Validator, data []byte) {
+	v = contentValidator(v, data)
+	if notModified(w, r, cacheControl, v) {
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	setCacheHeaders(w.Header(), cacheControl, v)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// marshalInfo returns the JSON encoding of the .info file ri.
+func marshalInfo(ri *RevInfo, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = json.NewEncoder(&buf).Encode(ri)
+	return buf.Bytes(), err
+}
+
+// serveZipFile serves the zip file of m from ops.ZipFile. v is the
+// Validator of the zip file, or nil.
+func serveZipFile(w http.ResponseWriter, r *http.Request, ops ServerOpsZipFile, m module.Version, cacheControl string, v *Validator) {
+	f, modTime, err := ops.ZipFile(r.Context(), m)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	if c, ok := f.(io.Closer); ok {
+		defer c.Close()
+	}
+	if v != nil && !v.ModTime.IsZero() {
+		modTime = v.ModTime
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	setCacheHeaders(w.Header(), cacheControl, v)
+	// http.ServeContent stops at a read error without reporting it, so
+	// the error is caught on the way to abort the response.
+	zw := &zipFileWriter{ResponseWriter: w}
+	http.ServeContent(zw, r, "", modTime, f)
+	if zw.err != nil {
+		abortResponse(w, zw.err)
+	}
+}
+
+// zipFileWriter records the first error of the copies that
+// http.ServeContent makes into it. It leaves the file itself to io.Copy,
+// rather than wrapping it, so that an *os.File still goes out with
+// sendfile.
+type zipFileWriter struct {
+	http.ResponseWriter
+	err error
+}
+
+func (zw *zipFileWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.Copy(zw.ResponseWriter, r)
+	if err != nil && zw.err == nil {
+		zw.err = err
+	}
+	return n, err
+}
+
+func (zw *zipFileWriter) Unwrap() http.ResponseWriter {
+	return zw.ResponseWriter
+}
+
+// latest returns the latest version of the module path from the Latest
+// method of the ServerOps, or failing that, the highest canonical release,
+// or prerelease if there is no release, from its Versions, as Repo.Latest
+// does when a proxy has no @latest.
+func (s *Server) latest(ctx context.Context, path string) (*RevInfo, error) {
+	if ops, ok := s.ops.(ServerOpsLatest); ok {
+		return ops.Latest(ctx, path)
+	}
+	versions, err := s.ops.Versions(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	v, err := latestVersion(versions)
+	if err != nil {
+		return nil, err
+	}
+	return s.ops.Stat(ctx, module.Version{Path: path, Version: v})
+}
+
+// versionValue returns the module version in the path of a request
+// routed to the remux.
+func versionValue(r *http.Request) (string, error) {
+	eversion, err := url.PathUnescape(r.PathValue("version"))
+	if err != nil {
+		return "", err
+	}
+	return module.UnescapeVersion(eversion)
+}
+
+// zipSpoolSize is how much of a zip file a Server buffers before sending
+// the response header.
+const zipSpoolSize = 1 << 20
+
+// spoolWriter buffers up to zipSpoolSize bytes written to it before
+// passing them on to w, which sends the response header.
+type spoolWriter struct {
+	w       http.ResponseWriter
+	buf     bytes.Buffer
+	flushed bool
+}
+
+func (sw *spoolWriter) Write(p []byte) (int, error) {
+	if !sw.flushed {
+		if sw.buf.Len()+len(p) <= zipSpoolSize {
+			return sw.buf.Write(p)
+		}
+		if err := sw.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return sw.w.Write(p)
+}
+
+// flush writes the buffered bytes to w, and stops buffering.
+func (sw *spoolWriter) flush() error {
+	sw.flushed = true
+	_, err := sw.w.Write(sw.buf.Bytes())
+	sw.buf = bytes.Buffer{}
+	return err
+}
+
+// abortResponse aborts a response whose status is sent already because
+// of err, by panicking with http.ErrAbortHandler, so that the client sees
+// a broken connection rather than a truncated body.
+func abortResponse(w http.ResponseWriter, err error) {
+	if rw, ok := w.(*responseWriter); ok {
+		rw.err = err
+	}
+	panic(http.ErrAbortHandler)
+}
+
 type sizeWriter struct {
 	W    io.Writer
 	Size int64
@@ -164,6 +377,108 @@ func (sw *sizeWriter) Write(p []byte) (int, error) {
 	return n, err
 }
 
+// SetLogger makes the Server log each request to logger: a "proxy
+// request start" record at level Debug, then a "proxy request" record
+// with the method, module, version, endpoint, status, bytes, duration and
+// error, as far as they are known. A nil logger turns logging off.
+func (s *Server) SetLogger(logger *slog.Logger) {
+	s.logger.Store(logger)
+}
+
+// SetTracer makes the Server start a span with tracer around each
+// request. The ServerOps get the span's context. A nil tracer turns
+// tracing off.
+func (s *Server) SetTracer(tracer Tracer) {
+	if tracer == nil {
+		s.tracer.Store(nil)
+		return
+	}
+	s.tracer.Store(&tracer)
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.mux.ServeHTTP(w, r)
+	logger := s.logger.Load()
+	var tracer Tracer
+	if t := s.tracer.Load(); t != nil {
+		tracer = *t
+	}
+	if logger == nil && tracer == nil {
+		s.mux.ServeHTTP(w, r)
+		return
+	}
+
+	op, modPath, version := parseRemotePath(r.URL.Path)
+	attrs := []slog.Attr{slog.String("method", r.Method), slog.String("module", modPath)}
+	if version != "" {
+		attrs = append(attrs, slog.String("version", version))
+	}
+	attrs = append(attrs, slog.String("endpoint", op))
+	if op == "" {
+		attrs = append(attrs, slog.String("path", r.URL.Path))
+	}
+	ctx, ev := startEvent(r.Context(), logger, tracer, "proxy.request", "proxy request", attrs...)
+	rw := &responseWriter{ResponseWriter: w}
+	defer func() {
+		v := recover()
+		status := rw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		err := rw.err
+		if err == nil && v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		} else if err == nil && status >= 400 {
+			err = &Error{Op: op, Module: modPath, Version: version, StatusCode: status}
+		}
+		attrs := []slog.Attr{slog.Int("status", status), slog.Int64("bytes", rw.size)}
+		if v != nil {
+			attrs = append(attrs, slog.Bool("aborted", true))
+		}
+		ev.finish(ctx, err, attrs...)
+		if v != nil {
+			panic(v)
+		}
+	}()
+	s.mux.ServeHTTP(rw, r.WithContext(ctx))
+}
+
+// responseWriter records the status and size of a response, and the
+// error it was aborted with.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+	err    error
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(p)
+	rw.size += int64(n)
+	return n, err
+}
+
+// ReadFrom passes r on to the ReadFrom method of the underlying
+// ResponseWriter through io.Copy, so that a file sent by
+// http.ServeContent still goes out with sendfile.
+func (rw *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := io.Copy(rw.ResponseWriter, r)
+	rw.size += n
+	return n, err
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
@@ -1,14 +1,22 @@
 package proxy_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jcbhmr/xmod/proxy"
 	"golang.org/x/mod/module"
@@ -161,3 +169,400 @@ func TestServer_Redirect(t *testing.T) {
 		t.Fatalf("expected %s, got %s", "v1.0.0", revInfo.Version)
 	}
 }
+
+// routeServerOps is a fixture for TestServer_Routes. Its latest version
+// differs from the highest one, so the fallback for ServerOps without
+// Latest can be told apart.
+func routeServerOps() *StaticServerOps {
+	m := module.Version{Path: "example.org/Awesome", Version: "v1.0.0"}
+	return &StaticServerOps{
+		RevInfos: map[string][]*proxy.RevInfo{
+			m.Path: {
+				{Version: "v0.0.1"},
+				{Version: "v1.0.0"},
+				{Version: "v1.1.0-RC"},
+			},
+		},
+		LatestVersion: map[string]string{
+			m.Path: "v1.0.0",
+		},
+		GoModData: map[module.Version][]byte{
+			m: []byte("module example.org/Awesome\n"),
+		},
+		ZipData: map[module.Version][]byte{
+			m: []byte("zip data"),
+		},
+	}
+}
+
+func TestServer_Routes(t *testing.T) {
+	withLatest := httptest.NewServer(proxy.NewServer(routeServerOps()))
+	defer withLatest.Close()
+	// Embedding the interface hides the Latest method.
+	withoutLatest := httptest.NewServer(proxy.NewServer(struct{ proxy.ServerOps }{routeServerOps()}))
+	defer withoutLatest.Close()
+
+	tests := []struct {
+		name        string
+		server      *httptest.Server
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{name: "list", server: withLatest, path: "/example.org/!awesome/@v/list", status: 200, contentType: "text/plain; charset=utf-8", body: "v0.0.1\nv1.0.0\nv1.1.0-RC\n"},
+		{name: "list missing", server: withLatest, path: "/example.org/missing/@v/list", status: 404},
+		{name: "latest", server: withLatest, path: "/example.org/!awesome/@latest", status: 200, contentType: "application/json", body: `{"Version":"v1.0.0"}` + "\n"},
+		{name: "latest fallback", server: withoutLatest, path: "/example.org/!awesome/@latest", status: 200, contentType: "application/json", body: `{"Version":"v1.0.0"}` + "\n"},
+		{name: "latest fallback missing", server: withoutLatest, path: "/example.org/missing/@latest", status: 404},
+		{name: "info", server: withLatest, path: "/example.org/!awesome/@v/v1.0.0.info", status: 200, contentType: "application/json", body: `{"Version":"v1.0.0"}` + "\n"},
+		{name: "info escaped version", server: withLatest, path: "/example.org/!awesome/@v/v1.1.0-!r!c.info", status: 200, contentType: "application/json", body: `{"Version":"v1.1.0-RC"}` + "\n"},
+		{name: "info missing", server: withLatest, path: "/example.org/!awesome/@v/v2.0.0.info", status: 404},
+		{name: "mod", server: withLatest, path: "/example.org/!awesome/@v/v1.0.0.mod", status: 200, contentType: "text/plain; charset=utf-8", body: "module example.org/Awesome\n"},
+		{name: "mod missing", server: withLatest, path: "/example.org/!awesome/@v/v0.0.1.mod", status: 404},
+		{name: "zip", server: withLatest, path: "/example.org/!awesome/@v/v1.0.0.zip", status: 200, contentType: "application/zip", body: "zip data"},
+		{name: "zip missing", server: withLatest, path: "/example.org/!awesome/@v/v0.0.1.zip", status: 404},
+		{name: "no @", server: withLatest, path: "/example.org/awesome", status: 400},
+		{name: "unknown route", server: withLatest, path: "/example.org/awesome/@bogus", status: 400},
+		{name: "unknown extension", server: withLatest, path: "/example.org/awesome/@v/v1.0.0.txt", status: 400},
+		{name: "unescaped path", server: withLatest, path: "/example.org/Awesome/@v/list", status: 400},
+		{name: "unescaped version", server: withLatest, path: "/example.org/!awesome/@v/v1.1.0-RC.info", status: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(tt.server.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d\n%s", resp.StatusCode, tt.status, body)
+			}
+			if tt.contentType != "" && resp.Header.Get("Content-Type") != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", resp.Header.Get("Content-Type"), tt.contentType)
+			}
+			if tt.body != "" && string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestServer_LatestFallbackMatchesClient(t *testing.T) {
+	ops := routeServerOps()
+	ops.LatestVersion = nil
+	withoutLatest := httptest.NewServer(proxy.NewServer(struct{ proxy.ServerOps }{ops}))
+	defer withoutLatest.Close()
+	// A proxy that has no @latest at all, so the client falls back too.
+	noLatest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/@latest") {
+			http.NotFound(w, r)
+			return
+		}
+		proxy.NewServer(ops).ServeHTTP(w, r)
+	}))
+	defer noLatest.Close()
+
+	var versions []string
+	for _, server := range []*httptest.Server{withoutLatest, noLatest} {
+		httpOps, err := proxy.NewHTTPOps(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo, err := proxy.NewClient(httpOps).Lookup("example.org/Awesome")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ri, err := repo.Latest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, ri.Version)
+	}
+	if versions[0] != versions[1] {
+		t.Fatalf("server fallback chose %s, client fallback chose %s", versions[0], versions[1])
+	}
+}
+
+// zipFileServerOps serves the zip files of a StaticServerOps from files
+// in dir.
+type zipFileServerOps struct {
+	*StaticServerOps
+	dir string
+}
+
+func (o *zipFileServerOps) ZipFile(ctx context.Context, m module.Version) (io.ReadSeeker, time.Time, error) {
+	data, ok := o.ZipData[m]
+	if !ok {
+		return nil, time.Time{}, fs.ErrNotExist
+	}
+	name := filepath.Join(o.dir, m.Version+".zip")
+	if err := os.WriteFile(name, data, 0o666); err != nil {
+		return nil, time.Time{}, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return f, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), nil
+}
+
+func TestServer_ZipFile(t *testing.T) {
+	for _, logged := range []bool{false, true} {
+		t.Run(fmt.Sprintf("logged=%v", logged), func(t *testing.T) {
+			handler := proxy.NewServer(&zipFileServerOps{routeServerOps(), t.TempDir()})
+			if logged {
+				handler.SetLogger(slog.New(slog.DiscardHandler))
+			}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			zip := server.URL + "/example.org/!awesome/@v/v1.0.0.zip"
+
+			tests := []struct {
+				name          string
+				method        string
+				url           string
+				header        http.Header
+				status        int
+				body          string
+				contentLength string
+			}{
+				{name: "full", method: "GET", url: zip, status: 200, body: "zip data", contentLength: "8"},
+				{name: "range", method: "GET", url: zip, header: http.Header{"Range": {"bytes=4-"}}, status: 206, body: "data", contentLength: "4"},
+				{name: "head", method: "HEAD", url: zip, status: 200, contentLength: "8"},
+				{name: "unsatisfiable range", method: "GET", url: zip, header: http.Header{"Range": {"bytes=100-"}}, status: 416},
+				{name: "missing", method: "GET", url: server.URL + "/example.org/!awesome/@v/v0.0.1.zip", status: 404},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					req, err := http.NewRequest(tt.method, tt.url, nil)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if tt.header != nil {
+						req.Header = tt.header
+					}
+					resp, err := http.DefaultClient.Do(req)
+					if err != nil {
+						t.Fatal(err)
+					}
+					defer resp.Body.Close()
+					body, err := io.ReadAll(resp.Body)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if resp.StatusCode != tt.status {
+						t.Fatalf("status %d, want %d\n%s", resp.StatusCode, tt.status, body)
+					}
+					if tt.status >= 400 {
+						return
+					}
+					if string(body) != tt.body {
+						t.Errorf("body %q, want %q", body, tt.body)
+					}
+					if got := resp.Header.Get("Content-Length"); got != tt.contentLength {
+						t.Errorf("Content-Length %q, want %q", got, tt.contentLength)
+					}
+					if got := resp.Header.Get("Content-Type"); got != "application/zip" {
+						t.Errorf("Content-Type %q", got)
+					}
+					if got := resp.Header.Get("Last-Modified"); got != "Tue, 02 Jan 2024 03:04:05 GMT" {
+						t.Errorf("Last-Modified %q", got)
+					}
+				})
+			}
+		})
+	}
+}
+
+// readerFromRecorder is a ResponseRecorder with a ReadFrom method, as
+// the ResponseWriter of net/http has for sendfile. It records the files
+// that reach ReadFrom.
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	files []*os.File
+}
+
+func (rr *readerFromRecorder) ReadFrom(r io.Reader) (int64, error) {
+	src := r
+	if lr, ok := r.(*io.LimitedReader); ok {
+		src = lr.R
+	}
+	if f, ok := src.(*os.File); ok {
+		rr.files = append(rr.files, f)
+	}
+	return io.Copy(rr.ResponseRecorder, r)
+}
+
+func TestServer_ZipFileReaderFrom(t *testing.T) {
+	for _, logged := range []bool{false, true} {
+		t.Run(fmt.Sprintf("logged=%v", logged), func(t *testing.T) {
+			handler := proxy.NewServer(&zipFileServerOps{routeServerOps(), t.TempDir()})
+			if logged {
+				handler.SetLogger(slog.New(slog.DiscardHandler))
+			}
+			rr := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", "/example.org/!awesome/@v/v1.0.0.zip", nil))
+			if rr.Code != 200 || rr.Body.String() != "zip data" {
+				t.Fatalf("status %d, body %q", rr.Code, rr.Body)
+			}
+			if len(rr.files) != 1 {
+				t.Errorf("ReadFrom got %d *os.File, want 1", len(rr.files))
+			}
+		})
+	}
+}
+
+// failingZipServerOps writes n bytes of a zip file, then fails.
+type failingZipServerOps struct {
+	*StaticServerOps
+	n int
+}
+
+func (o *failingZipServerOps) Zip(ctx context.Context, dst io.Writer, m module.Version) error {
+	if _, err := dst.Write(bytes.Repeat([]byte("z"), o.n)); err != nil {
+		return err
+	}
+	return errors.New("disk on fire")
+}
+
+func TestServer_ZipFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		status  int
+		aborted bool
+	}{
+		{name: "before writing", n: 0, status: 500},
+		{name: "spooled", n: 10, status: 500},
+		{name: "streamed", n: 2 << 20, status: 200, aborted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := proxy.NewServer(&failingZipServerOps{routeServerOps(), tt.n})
+			var buf bytes.Buffer
+			handler.SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + "/example.org/!awesome/@v/v1.0.0.zip")
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.aborted {
+				if err == nil {
+					t.Fatalf("read %d bytes of an aborted response without error", len(body))
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(body), "disk on fire") {
+					t.Errorf("body %q does not hold the error", body)
+				}
+				if cc := resp.Header.Get("Cache-Control"); cc != "" {
+					t.Errorf("error response has Cache-Control %q", cc)
+				}
+			}
+
+			server.Close()
+			records := logRecords(t, &buf)
+			if len(records) != 1 {
+				t.Fatalf("expected 1 record, got %v", records)
+			}
+			rec := records[0]
+			wantErr := "500 Internal Server Error"
+			if tt.aborted {
+				wantErr = "disk on fire"
+			}
+			if rec["level"] != "WARN" || !strings.Contains(fmt.Sprint(rec["error"]), wantErr) {
+				t.Errorf("record %v does not report %q", rec, wantErr)
+			}
+			if (rec["aborted"] == true) != tt.aborted {
+				t.Errorf("record %v: aborted = %v, want %v", rec, rec["aborted"], tt.aborted)
+			}
+		})
+	}
+}
+
+func TestServer_ZipContentLength(t *testing.T) {
+	server := httptest.NewServer(proxy.NewServer(routeServerOps()))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/example.org/!awesome/@v/v1.0.0.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ContentLength != int64(len("zip data")) {
+		t.Errorf("ContentLength = %d, want %d", resp.ContentLength, len("zip data"))
+	}
+}
+
+// failingReadSeeker reads from a ReadSeeker until the offset fail, then
+// fails.
+type failingReadSeeker struct {
+	io.ReadSeeker
+	off, fail int64
+}
+
+func (f *failingReadSeeker) Read(p []byte) (int, error) {
+	if f.off >= f.fail {
+		return 0, errors.New("disk on fire")
+	}
+	p = p[:min(int64(len(p)), f.fail-f.off)]
+	n, err := f.ReadSeeker.Read(p)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *failingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	off, err := f.ReadSeeker.Seek(offset, whence)
+	f.off = off
+	return off, err
+}
+
+// failingZipFileServerOps serves zip files whose reads fail halfway.
+type failingZipFileServerOps struct {
+	*StaticServerOps
+}
+
+func (o *failingZipFileServerOps) ZipFile(ctx context.Context, m module.Version) (io.ReadSeeker, time.Time, error) {
+	data := bytes.Repeat([]byte("z"), 2<<20)
+	return &failingReadSeeker{ReadSeeker: bytes.NewReader(data), fail: 1 << 20}, time.Time{}, nil
+}
+
+func TestServer_ZipFileFailure(t *testing.T) {
+	handler := proxy.NewServer(&failingZipFileServerOps{routeServerOps()})
+	var buf bytes.Buffer
+	handler.SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/example.org/!awesome/@v/v1.0.0.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err == nil {
+		t.Fatalf("read %d bytes of an aborted response without error", len(body))
+	}
+
+	server.Close()
+	records := logRecords(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %v", records)
+	}
+	if rec := records[0]; rec["aborted"] != true || !strings.Contains(fmt.Sprint(rec["error"]), "disk on fire") {
+		t.Errorf("record %v does not report the aborted response", rec)
+	}
+}
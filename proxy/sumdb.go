@@ -0,0 +1,335 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// DefaultGOSUMDB is the GOSUMDB value used when none is set.
+const DefaultGOSUMDB = "sum.golang.org"
+
+var knownGOSUMDB = map[string]string{
+	"sum.golang.org": "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ln0+bWSzbW6gS5c9",
+}
+
+// A ChecksumMismatchError reports downloaded module content whose hash
+// differs from the one recorded in the checksum database.
+type ChecksumMismatchError struct {
+	// Module is the module version. Its Version ends in "/go.mod" if the
+	// mismatch is for the go.mod file alone.
+	Module module.Version
+
+	Downloaded string // hash of the downloaded content
+	SumDB      string // name of the checksum database
+	Want       string // hash recorded in the checksum database
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("verifying %s@%s: checksum mismatch\n\tdownloaded: %s\n\t%s: %s\n\n"+
+		"SECURITY ERROR\nThis download does NOT match the one reported by the checksum server.\n"+
+		"The bits may have been replaced on the origin server, or an attacker may\n"+
+		"have intercepted the download attempt.",
+		e.Module.Path, e.Module.Version, e.Downloaded, e.SumDB, e.Want)
+}
+
+// A SumDB verifies module hashes against a checksum database.
+//
+// https://go.dev/ref/mod#checksum-database
+type SumDB struct {
+	// Client is used for HTTP requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// Logger receives log and security messages. If nil, log messages
+	// are discarded and security messages go to log.Default().
+	Logger *log.Logger
+
+	name string
+	key  string
+	base string
+
+	mu     sync.Mutex
+	latest []byte
+	cache  map[string][]byte
+}
+
+// NewSumDB returns a SumDB for a GOSUMDB value, which is "name",
+// "name+key" or "name+key url". An empty value means DefaultGOSUMDB.
+// NewSumDB returns an error for "off"; callers should check for it first.
+func NewSumDB(gosumdb string) (*SumDB, error) {
+	// This mirrors dbDial in cmd/go/internal/modfetch.
+	if gosumdb == "" {
+		gosumdb = DefaultGOSUMDB
+	}
+	if gosumdb == "sum.golang.google.cn" {
+		gosumdb = "sum.golang.org https://sum.golang.google.cn"
+	}
+	if gosumdb == "off" {
+		return nil, fmt.Errorf("checksum database disabled by GOSUMDB=off")
+	}
+
+	key := strings.Fields(gosumdb)
+	if len(key) >= 1 {
+		if k := knownGOSUMDB[key[0]]; k != "" {
+			key[0] = k
+		}
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("missing GOSUMDB")
+	}
+	if len(key) > 2 {
+		return nil, fmt.Errorf("invalid GOSUMDB: too many fields")
+	}
+	vkey, err := note.NewVerifier(key[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid GOSUMDB: %v", err)
+	}
+	name := vkey.Name()
+
+	// No funny business in the database name.
+	direct, err := url.Parse("https://" + name)
+	if err != nil || strings.HasSuffix(name, "/") || *direct != (url.URL{Scheme: "https", Host: direct.Host, Path: direct.Path, RawPath: direct.RawPath}) || direct.RawPath != "" || direct.Host == "" {
+		return nil, fmt.Errorf("invalid sumdb name (must be host[/path]): %s", name)
+	}
+
+	base := direct.String()
+	if len(key) >= 2 {
+		// Use explicit alternate URL listed in $GOSUMDB.
+		u, err := url.Parse(key[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid GOSUMDB URL: %v", err)
+		}
+		base = u.String()
+	}
+
+	return &SumDB{name: name, key: key[0], base: strings.TrimSuffix(base, "/")}, nil
+}
+
+// Name returns the name of the checksum database, such as "sum.golang.org".
+func (db *SumDB) Name() string {
+	return db.name
+}
+
+// client returns a sumdb.Client for db whose reads use ctx. The latest
+// signed tree and the tile cache are kept in db, and so shared by all of
+// them.
+func (db *SumDB) client(ctx context.Context) *sumdb.Client {
+	return sumdb.NewClient(&sumdbOps{db: db, ctx: ctx})
+}
+
+// Lookup returns the go.sum lines recorded for the module version. If the
+// version ends in "/go.mod", only the go.mod hash is returned.
+func (db *SumDB) Lookup(path, version string) ([]string, error) {
+	return db.LookupContext(context.Background(), path, version)
+}
+
+// LookupContext is like Lookup, but reads from the checksum database with
+// ctx.
+func (db *SumDB) LookupContext(ctx context.Context, path, version string) ([]string, error) {
+	lines, err := db.client(ctx).Lookup(path, version)
+	if err != nil && ctx.Err() != nil {
+		// sumdb.Client flattens errors into text, which would hide that
+		// the lookup was canceled.
+		return nil, ctx.Err()
+	}
+	return lines, err
+}
+
+// ReadRemoteContext reads the file at path, such as "/latest",
+// "/lookup/golang.org/x/mod@v0.24.0" or "/tile/8/0/001", from the checksum
+// database. An unsuccessful response is returned as an *Error.
+func (db *SumDB) ReadRemoteContext(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, db.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := db.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &Error{
+			URL:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(string(body)),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// CheckGoMod checks the go.mod file data of a module version.
+func (db *SumDB) CheckGoMod(path, version string, data []byte) error {
+	return db.CheckGoModContext(context.Background(), path, version, data)
+}
+
+// CheckGoModContext is like CheckGoMod, but reads from the checksum
+// database with ctx.
+func (db *SumDB) CheckGoModContext(ctx context.Context, path, version string, data []byte) error {
+	h, err := hashGoMod(data)
+	if err != nil {
+		return err
+	}
+	return db.check(ctx, module.Version{Path: path, Version: version + "/go.mod"}, h)
+}
+
+// CheckZipFile checks the module zip file with the given name.
+func (db *SumDB) CheckZipFile(path, version string, zipfile string) error {
+	return db.CheckZipFileContext(context.Background(), path, version, zipfile)
+}
+
+// CheckZipFileContext is like CheckZipFile, but reads from the checksum
+// database with ctx.
+func (db *SumDB) CheckZipFileContext(ctx context.Context, path, version string, zipfile string) error {
+	h, err := dirhash.HashZip(zipfile, dirhash.Hash1)
+	if err != nil {
+		return err
+	}
+	return db.check(ctx, module.Version{Path: path, Version: version}, h)
+}
+
+func (db *SumDB) check(ctx context.Context, mod module.Version, h string) error {
+	lines, err := db.LookupContext(ctx, mod.Path, mod.Version)
+	if err != nil {
+		return err
+	}
+	prefix := mod.Path + " " + mod.Version + " "
+	var want string
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			want = strings.TrimPrefix(line, prefix)
+			if want == h {
+				return nil
+			}
+		}
+	}
+	return &ChecksumMismatchError{Module: mod, Downloaded: h, SumDB: db.name, Want: want}
+}
+
+// hashGoMod returns the go.sum hash of a go.mod file.
+func hashGoMod(data []byte) (string, error) {
+	return dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+}
+
+// sumdbOps implements sumdb.ClientOps for a call to a SumDB, reading with
+// the context of the call, and keeping the latest signed tree and the tile
+// cache in memory in the SumDB.
+type sumdbOps struct {
+	db  *SumDB
+	ctx context.Context
+}
+
+func (ops *sumdbOps) ReadRemote(path string) ([]byte, error) {
+	return ops.db.ReadRemoteContext(ops.ctx, path)
+}
+
+func (ops *sumdbOps) ReadConfig(file string) ([]byte, error) {
+	db := ops.db
+	if file == "key" {
+		return []byte(db.key), nil
+	}
+	if strings.HasSuffix(file, "/latest") {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		return db.latest, nil
+	}
+	return nil, fmt.Errorf("unknown config %s", file)
+}
+
+func (ops *sumdbOps) WriteConfig(file string, old, new []byte) error {
+	db := ops.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if !bytes.Equal(db.latest, old) {
+		return sumdb.ErrWriteConflict
+	}
+	db.latest = new
+	return nil
+}
+
+func (ops *sumdbOps) ReadCache(file string) ([]byte, error) {
+	db := ops.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	data, ok := db.cache[file]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return data, nil
+}
+
+func (ops *sumdbOps) WriteCache(file string, data []byte) {
+	db := ops.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.cache == nil {
+		db.cache = map[string][]byte{}
+	}
+	db.cache[file] = data
+}
+
+func (ops *sumdbOps) Log(msg string) {
+	if ops.db.Logger != nil {
+		ops.db.Logger.Print(msg)
+	}
+}
+
+func (ops *sumdbOps) SecurityError(msg string) {
+	logger := ops.db.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Print(msg)
+}
+
+// verifyZip spools a module zip from src to a temporary file, checks it
+// against db, and copies it to dst only if it matches.
+func verifyZip(ctx context.Context, db *SumDB, dst io.Writer, path, version string, src io.Reader) error {
+	f, err := os.CreateTemp("", "modzip-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = io.Copy(f, &ctxReader{ctx, src})
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	err = db.CheckZipFileContext(ctx, path, version, f.Name())
+	if err != nil {
+		return err
+	}
+	f, err = os.Open(f.Name())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(dst, &ctxReader{ctx, f})
+	return err
+}
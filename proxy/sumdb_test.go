@@ -0,0 +1,188 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jcbhmr/xmod/proxy"
+	xzip "github.com/jcbhmr/xmod/zip"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+	modzip "golang.org/x/mod/zip"
+)
+
+func makeModuleZip(t *testing.T, m module.Version, files fstest.MapFS) []byte {
+	t.Helper()
+	zfiles, err := xzip.Files(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := &bytes.Buffer{}
+	err = modzip.Create(buffer, m, zfiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// goSumLines returns the go.sum lines for a module version.
+func goSumLines(t *testing.T, m module.Version, goMod, zipData []byte) []byte {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "mod.zip")
+	err := os.WriteFile(name, zipData, 0o666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipHash, err := dirhash.HashZip(name, dirhash.Hash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modHash, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(goMod)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(m.Path + " " + m.Version + " " + zipHash + "\n" + m.Path + " " + m.Version + "/go.mod " + modHash + "\n")
+}
+
+// newTestSumDB starts a checksum database that records the given go.sum
+// lines and returns its GOSUMDB value.
+func newTestSumDB(t *testing.T, sums map[module.Version][]byte) string {
+	t.Helper()
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sum.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := sumdb.NewTestServer(skey, func(path, vers string) ([]byte, error) {
+		data, ok := sums[module.Version{Path: path, Version: vers}]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return data, nil
+	})
+	server := httptest.NewServer(sumdb.NewServer(ts))
+	t.Cleanup(server.Close)
+	return vkey + " " + server.URL
+}
+
+func TestRepo_SumDB(t *testing.T) {
+	m := module.Version{Path: "example.org/awesome", Version: "v1.0.0"}
+	goMod := []byte("module example.org/awesome\n")
+	zipData := makeModuleZip(t, m, fstest.MapFS{
+		"go.mod":     {Data: goMod},
+		"awesome.go": {Data: []byte("package awesome\n")},
+	})
+	gosumdb := newTestSumDB(t, map[module.Version][]byte{
+		m: goSumLines(t, m, goMod, zipData),
+	})
+
+	newRepo := func(t *testing.T, goMod, zipData []byte, cfg *proxy.Config) *proxy.Repo {
+		server := httptest.NewServer(proxy.NewServer(&StaticServerOps{
+			RevInfos:  map[string][]*proxy.RevInfo{m.Path: {{Version: m.Version}}},
+			GoModData: map[module.Version][]byte{m: goMod},
+			ZipData:   map[module.Version][]byte{m: zipData},
+		}))
+		t.Cleanup(server.Close)
+		ops, err := proxy.NewHTTPOps(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.GOSUMDB = gosumdb
+		db, err := cfg.NewSumDB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := proxy.NewClientConfig(ops, cfg)
+		client.SetSumDB(db)
+		repo, err := client.Lookup(m.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	}
+
+	t.Run("match", func(t *testing.T) {
+		repo := newRepo(t, goMod, zipData, &proxy.Config{})
+		_, err := repo.GoMod(m.Version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buffer := &bytes.Buffer{}
+		err = repo.Zip(buffer, m.Version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buffer.Bytes(), zipData) {
+			t.Fatal("zip data changed in transit")
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		badGoMod := []byte("module example.org/awesome\n\nrequire example.org/evil v1.0.0\n")
+		badZip := makeModuleZip(t, m, fstest.MapFS{
+			"go.mod":     {Data: goMod},
+			"awesome.go": {Data: []byte("package awesome\n\nimport _ \"example.org/evil\"\n")},
+		})
+		repo := newRepo(t, badGoMod, badZip, &proxy.Config{})
+		var mismatch *proxy.ChecksumMismatchError
+		_, err := repo.GoMod(m.Version)
+		if !errors.As(err, &mismatch) {
+			t.Fatalf("expected *ChecksumMismatchError, got %v", err)
+		}
+		if mismatch.Module.Version != m.Version+"/go.mod" {
+			t.Fatalf("expected mismatch for %s/go.mod, got %s", m.Version, mismatch.Module.Version)
+		}
+		buffer := &bytes.Buffer{}
+		err = repo.Zip(buffer, m.Version)
+		if !errors.As(err, &mismatch) {
+			t.Fatalf("expected *ChecksumMismatchError, got %v", err)
+		}
+		if buffer.Len() != 0 {
+			t.Fatal("mismatched zip was written to dst")
+		}
+	})
+
+	t.Run("GONOSUMDB", func(t *testing.T) {
+		badGoMod := []byte("module example.org/awesome\n\ngo 1.24\n")
+		repo := newRepo(t, badGoMod, zipData, &proxy.Config{GONOSUMDB: "example.org"})
+		_, err := repo.GoMod(m.Version)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestSumDB_LookupContext(t *testing.T) {
+	_, vkey, err := note.GenerateKey(rand.Reader, "sum.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A checksum database that never answers.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	db, err := proxy.NewSumDB(vkey + " " + server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = db.LookupContext(ctx, "example.org/awesome", "v1.0.0")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
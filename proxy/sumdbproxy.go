@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// SumDBOps fetches the files of a checksum database that a Server
+// proxies. A *SumDB implements SumDBOps.
+type SumDBOps interface {
+	// Name returns the name of the checksum database, such as
+	// "sum.golang.org".
+	Name() string
+	// ReadRemoteContext reads the file at path, such as "/latest",
+	// "/lookup/golang.org/x/mod@v0.24.0" or "/tile/8/0/001", from the
+	// checksum database.
+	ReadRemoteContext(ctx context.Context, path string) ([]byte, error)
+}
+
+// SetSumDB makes the Server proxy the checksum database of ops, answering
+// /sumdb/<name>/supported, and serving /sumdb/<name>/latest,
+// /sumdb/<name>/lookup/... and /sumdb/<name>/tile/... from ops, so that
+// the go command can verify modules through the Server alone. Tiles are
+// served as immutable, and full tiles are kept in memory, up to
+// sumdbTileCacheSize bytes, so that they are read from ops only once. A
+// nil ops turns proxying off, and the Server then answers 404 Not Found,
+// which tells the go command to reach the checksum database directly.
+//
+// https://go.dev/ref/mod#goproxy-protocol
+func (s *Server) SetSumDB(ops SumDBOps) {
+	if ops == nil {
+		s.sumdb.Store(nil)
+		return
+	}
+	s.sumdb.Store(&sumdbProxy{ops: ops})
+}
+
+// sumdbTileCacheSize is the most bytes of full tiles that a Server keeps
+// in memory for the checksum database it proxies.
+const sumdbTileCacheSize = 64 << 20
+
+// sumdbProxy is the checksum database that a Server proxies, with the
+// full tiles read from it.
+type sumdbProxy struct {
+	ops SumDBOps
+
+	mu    sync.Mutex
+	tiles map[string][]byte
+	size  int
+}
+
+// readTile reads the tile file from the checksum database, or from memory
+// if it is a full tile that was read before. Partial tiles are not kept,
+// as clients move on to wider ones while the checksum database grows.
+func (sp *sumdbProxy) readTile(ctx context.Context, file string, t tlog.Tile) ([]byte, error) {
+	full := t.W == 1<<t.H
+	if full {
+		sp.mu.Lock()
+		data, ok := sp.tiles[file]
+		sp.mu.Unlock()
+		if ok {
+			return data, nil
+		}
+	}
+	data, err := sp.ops.ReadRemoteContext(ctx, "/"+file)
+	if err != nil || !full {
+		return data, err
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if _, ok := sp.tiles[file]; !ok {
+		for name, tile := range sp.tiles {
+			if sp.size+len(data) <= sumdbTileCacheSize {
+				break
+			}
+			// Map order is random enough to pick what to drop.
+			delete(sp.tiles, name)
+			sp.size -= len(tile)
+		}
+		if sp.tiles == nil {
+			sp.tiles = map[string][]byte{}
+		}
+		sp.tiles[file] = data
+		sp.size += len(data)
+	}
+	return data, nil
+}
+
+// serveSumDB serves a /sumdb/ request.
+func (s *Server) serveSumDB(w http.ResponseWriter, r *http.Request) {
+	sp := s.sumdb.Load()
+	if sp == nil {
+		http.NotFound(w, r)
+		return
+	}
+	ops := sp.ops
+	file, ok := strings.CutPrefix(r.PathValue("rest"), ops.Name()+"/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	read := ops.ReadRemoteContext
+	var contentType, cacheControl string
+	switch {
+	case file == "supported":
+		w.WriteHeader(http.StatusOK)
+		return
+	case file == "latest":
+		contentType, cacheControl = "text/plain; charset=utf-8", mutableCacheControl
+	case strings.HasPrefix(file, "lookup/"):
+		if err := checkLookupPath(strings.TrimPrefix(file, "lookup/")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		contentType, cacheControl = "text/plain; charset=utf-8", mutableCacheControl
+	case strings.HasPrefix(file, "tile/"):
+		t, err := tlog.ParseTilePath(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		read = func(ctx context.Context, path string) ([]byte, error) {
+			return sp.readTile(ctx, file, t)
+		}
+		// A tile, even a partial one, never changes once published.
+		contentType, cacheControl = "application/octet-stream", immutableCacheControl
+	default:
+		http.Error(w, fmt.Sprintf("unknown checksum database file %q", file), http.StatusBadRequest)
+		return
+	}
+	data, err := read(r.Context(), "/"+file)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	serveBytes(w, r, contentType, cacheControl, nil, data)
+}
+
+// checkLookupPath checks the escaped "path@version" of a lookup.
+func checkLookupPath(p string) error {
+	epath, eversion, ok := strings.Cut(p, "@")
+	if !ok {
+		return fmt.Errorf("invalid lookup %q: no version", p)
+	}
+	if _, err := module.UnescapePath(epath); err != nil {
+		return err
+	}
+	if _, err := module.UnescapeVersion(eversion); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package proxy_test
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jcbhmr/xmod/proxy"
+	"golang.org/x/mod/module"
+)
+
+func TestServer_SetSumDB(t *testing.T) {
+	m := module.Version{Path: "example.org/awesome", Version: "v1.0.0"}
+	goMod := []byte("module example.org/awesome\n")
+	zipData := makeModuleZip(t, m, fstest.MapFS{
+		"go.mod":     {Data: goMod},
+		"awesome.go": {Data: []byte("package awesome\n")},
+	})
+	gosumdb := newTestSumDB(t, map[module.Version][]byte{
+		m: goSumLines(t, m, goMod, zipData),
+	})
+	upstream, err := proxy.NewSumDB(gosumdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := proxy.NewServer(&StaticServerOps{})
+	handler.SetSumDB(upstream)
+	var mu sync.Mutex
+	cacheControl := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+		mu.Lock()
+		cacheControl[r.URL.Path] = w.Header().Get("Cache-Control")
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	// The go command reaches a proxied checksum database at
+	// <proxy>/sumdb/<name>.
+	key, _, _ := strings.Cut(gosumdb, " ")
+	db, err := proxy.NewSumDB(key + " " + server.URL + "/sumdb/" + upstream.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err := db.Lookup(m.Path, m.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], m.Path+" "+m.Version+" h1:") {
+		t.Fatalf("unexpected go.sum lines %q", lines)
+	}
+
+	mu.Lock()
+	var tiles int
+	for p, cc := range cacheControl {
+		switch {
+		case strings.Contains(p, "/tile/"):
+			tiles++
+			if cc != "public, max-age=31536000, immutable" {
+				t.Errorf("%s: Cache-Control %q", p, cc)
+			}
+		case strings.Contains(p, "/lookup/"):
+			if cc != "public, max-age=60" {
+				t.Errorf("%s: Cache-Control %q", p, cc)
+			}
+		}
+	}
+	mu.Unlock()
+	if tiles == 0 {
+		t.Errorf("no tiles fetched through the proxy: %v", cacheControl)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{path: "/sumdb/" + upstream.Name() + "/supported", status: 200},
+		{path: "/sumdb/sum.golang.org/supported", status: 404},
+		{path: "/sumdb/" + upstream.Name() + "/latest", status: 200},
+		{path: "/sumdb/" + upstream.Name() + "/tile/bogus", status: 400},
+		{path: "/sumdb/" + upstream.Name() + "/lookup/example.org/Awesome@v1.0.0", status: 400},
+		{path: "/sumdb/" + upstream.Name() + "/signed", status: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+
+	t.Run("off", func(t *testing.T) {
+		handler.SetSumDB(nil)
+		resp, err := http.Get(server.URL + "/sumdb/" + upstream.Name() + "/supported")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("status %d, want 404", resp.StatusCode)
+		}
+	})
+}
+
+// countingSumDBOps serves the files of a checksum database from memory,
+// counting reads.
+type countingSumDBOps struct {
+	files map[string][]byte
+
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func (c *countingSumDBOps) Name() string {
+	return "sum.example.org"
+}
+
+func (c *countingSumDBOps) ReadRemoteContext(ctx context.Context, path string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reads == nil {
+		c.reads = map[string]int{}
+	}
+	c.reads[path]++
+	data, ok := c.files[path]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return data, nil
+}
+
+func TestServer_SumDBTileCache(t *testing.T) {
+	ops := &countingSumDBOps{files: map[string][]byte{
+		"/tile/8/0/000":     []byte("full tile"),
+		"/tile/8/0/001.p/5": []byte("partial tile"),
+		"/latest":           []byte("tree"),
+	}}
+	handler := proxy.NewServer(&StaticServerOps{})
+	handler.SetSumDB(ops)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for range 3 {
+		for p := range ops.files {
+			resp, err := http.Get(server.URL + "/sumdb/sum.example.org" + p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("%s: status %d", p, resp.StatusCode)
+			}
+		}
+	}
+	resp, err := http.Get(server.URL + "/sumdb/sum.example.org/tile/8/0/002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing tile: status %d, want 404", resp.StatusCode)
+	}
+
+	want := map[string]int{
+		"/tile/8/0/000":     1,
+		"/tile/8/0/001.p/5": 3,
+		"/latest":           3,
+	}
+	for p, n := range want {
+		if ops.reads[p] != n {
+			t.Errorf("%s: expected %d upstream reads, got %d", p, n, ops.reads[p])
+		}
+	}
+}
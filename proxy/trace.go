@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// A Tracer starts spans around the remote reads of a Client and the
+// requests a Server handles, so that they can be attached to a
+// distributed trace.
+type Tracer interface {
+	// Start starts a span named "proxy.fetch" or "proxy.request" with
+	// the given attributes. The returned context is passed on to the
+	// ClientOps or ServerOps.
+	Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span)
+}
+
+// A Span is a span started by a Tracer.
+type Span interface {
+	// End ends the span, with the error it failed with or nil, and
+	// attributes known only once it is done, such as "bytes".
+	End(err error, attrs ...slog.Attr)
+}
+
+// fetchInfoKey is the context key for the *fetchInfo of a remote read.
+type fetchInfoKey struct{}
+
+// fetchInfo collects what the ClientOps of a remote read learn about it.
+type fetchInfo struct {
+	mu       sync.Mutex
+	upstream string
+	cache    string
+	retries  int
+}
+
+func getFetchInfo(ctx context.Context) *fetchInfo {
+	info, _ := ctx.Value(fetchInfoKey{}).(*fetchInfo)
+	return info
+}
+
+// noteUpstream records which GOPROXY entry answered a remote read.
+func noteUpstream(ctx context.Context, upstream string) {
+	if info := getFetchInfo(ctx); info != nil {
+		info.mu.Lock()
+		info.upstream = upstream
+		info.mu.Unlock()
+	}
+}
+
+// noteCache records whether a remote read was served from a cache.
+func noteCache(ctx context.Context, hit bool) {
+	if info := getFetchInfo(ctx); info != nil {
+		info.mu.Lock()
+		info.cache = "miss"
+		if hit {
+			info.cache = "hit"
+		}
+		info.mu.Unlock()
+	}
+}
+
+// noteRetry records that a remote read was retried.
+func noteRetry(ctx context.Context) {
+	if info := getFetchInfo(ctx); info != nil {
+		info.mu.Lock()
+		info.retries++
+		info.mu.Unlock()
+	}
+}
+
+// An event is a remote read or a request being logged and traced.
+type event struct {
+	logger *slog.Logger
+	span   Span
+	msg    string
+	start  time.Time
+	attrs  []slog.Attr
+}
+
+// startEvent logs the start of an event and starts its span. It returns
+// nil if there is neither a logger nor a tracer.
+func startEvent(ctx context.Context, logger *slog.Logger, tracer Tracer, name, msg string, attrs ...slog.Attr) (context.Context, *event) {
+	if logger == nil && tracer == nil {
+		return ctx, nil
+	}
+	ev := &event{logger: logger, msg: msg, start: time.Now(), attrs: attrs}
+	if tracer != nil {
+		ctx, ev.span = tracer.Start(ctx, name, attrs...)
+	}
+	if logger != nil {
+		logger.LogAttrs(ctx, slog.LevelDebug, msg+" start", attrs...)
+	}
+	return ctx, ev
+}
+
+// finish ends the event, logging it at level Info, or at level Warn if it
+// failed with an error other than fs.ErrNotExist.
+func (ev *event) finish(ctx context.Context, err error, attrs ...slog.Attr) {
+	if ev == nil {
+		return
+	}
+	if ev.span != nil {
+		ev.span.End(err, attrs...)
+	}
+	if ev.logger == nil {
+		return
+	}
+	level := slog.LevelInfo
+	all := append(ev.attrs[:len(ev.attrs):len(ev.attrs)], attrs...)
+	all = append(all, slog.Duration("duration", time.Since(ev.start)))
+	if err != nil {
+		all = append(all, slog.String("error", err.Error()))
+		if !errors.Is(err, fs.ErrNotExist) {
+			level = slog.LevelWarn
+		}
+	}
+	ev.logger.LogAttrs(ctx, level, ev.msg, all...)
+}
+
+// startFetch starts the event for a remote read of the given path by a
+// Repo of c.
+func (c *Client) startFetch(ctx context.Context, path string) (context.Context, *event) {
+	logger := c.logger.Load()
+	var tracer Tracer
+	if t := c.tracer.Load(); t != nil {
+		tracer = *t
+	}
+	if logger == nil && tracer == nil {
+		return ctx, nil
+	}
+	op, modPath, version := parseRemotePath(path)
+	attrs := []slog.Attr{slog.String("module", modPath)}
+	if version != "" {
+		attrs = append(attrs, slog.String("version", version))
+	}
+	attrs = append(attrs, slog.String("endpoint", op))
+	ctx = context.WithValue(ctx, fetchInfoKey{}, &fetchInfo{})
+	return startEvent(ctx, logger, tracer, "proxy.fetch", "proxy fetch", attrs...)
+}
+
+// finishFetch ends the event for a remote read that returned n bytes.
+func finishFetch(ctx context.Context, ev *event, n int64, err error) {
+	if ev == nil {
+		return
+	}
+	attrs := []slog.Attr{slog.Int64("bytes", n)}
+	if info := getFetchInfo(ctx); info != nil {
+		info.mu.Lock()
+		if info.upstream != "" {
+			attrs = append(attrs, slog.String("upstream", info.upstream))
+		}
+		if info.cache != "" {
+			attrs = append(attrs, slog.String("cache", info.cache))
+		}
+		if info.retries > 0 {
+			attrs = append(attrs, slog.Int("retries", info.retries))
+		}
+		info.mu.Unlock()
+	}
+	ev.finish(ctx, err, attrs...)
+}
@@ -0,0 +1,186 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/jcbhmr/xmod/proxy"
+	"golang.org/x/mod/module"
+)
+
+// logRecords decodes the JSON log records in buf.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	dec := json.NewDecoder(buf)
+	for {
+		var rec map[string]any
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+type recordingSpan struct {
+	name  string
+	attrs []slog.Attr
+	ended bool
+	err   error
+}
+
+func (rt *recordingTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, proxy.Span) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	span := &recordingSpan{name: name, attrs: attrs}
+	rt.spans = append(rt.spans, span)
+	return ctx, span
+}
+
+func (rs *recordingSpan) End(err error, attrs ...slog.Attr) {
+	rs.ended = true
+	rs.err = err
+	rs.attrs = append(rs.attrs, attrs...)
+}
+
+func TestClient_SetLogger(t *testing.T) {
+	m := module.Version{Path: "example.org/awesome", Version: "v1.0.0"}
+	server := httptest.NewServer(proxy.NewServer(&StaticServerOps{
+		RevInfos: map[string][]*proxy.RevInfo{m.Path: {{Version: m.Version}}},
+		ZipData:  map[module.Version][]byte{m: []byte("zip data")},
+	}))
+	defer server.Close()
+	httpOps, err := proxy.NewHTTPOps(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := proxy.NewClient(proxy.NewCacheOps(httpOps, t.TempDir(), 0))
+	var buf bytes.Buffer
+	client.SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	tracer := &recordingTracer{}
+	client.SetTracer(tracer)
+
+	repo, err := client.Lookup(m.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		_, err = repo.Stat(m.Version)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = repo.Zip(io.Discard, m.Version)
+	if err == nil {
+		t.Fatal("expected error for a zip that is not a module zip")
+	}
+	_, err = repo.GoMod(m.Version)
+	if err == nil {
+		t.Fatal("expected error for a missing go.mod")
+	}
+
+	records := logRecords(t, &buf)
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records at level Info, got %d: %v", len(records), records)
+	}
+	want := []map[string]any{
+		{"level": "INFO", "msg": "proxy fetch", "module": m.Path, "version": m.Version, "endpoint": "info", "upstream": server.URL, "cache": "miss"},
+		{"level": "INFO", "msg": "proxy fetch", "endpoint": "info", "cache": "hit"},
+		{"level": "WARN", "msg": "proxy fetch", "endpoint": "zip", "cache": "miss"},
+		{"level": "INFO", "msg": "proxy fetch", "endpoint": "mod", "bytes": float64(0)},
+	}
+	for i, w := range want {
+		for k, v := range w {
+			if records[i][k] != v {
+				t.Errorf("record %d: %s = %v, want %v", i, k, records[i][k], v)
+			}
+		}
+		if _, ok := records[i]["duration"]; !ok {
+			t.Errorf("record %d: no duration", i)
+		}
+	}
+	if records[0]["bytes"] != records[1]["bytes"] || records[0]["bytes"] == float64(0) {
+		t.Errorf("bytes of cache miss and hit = %v and %v", records[0]["bytes"], records[1]["bytes"])
+	}
+	if _, ok := records[3]["error"]; !ok {
+		t.Errorf("record 3: no error")
+	}
+
+	if len(tracer.spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d", len(tracer.spans))
+	}
+	for _, span := range tracer.spans {
+		if span.name != "proxy.fetch" || !span.ended {
+			t.Errorf("unexpected span %+v", span)
+		}
+	}
+	if tracer.spans[3].err == nil {
+		t.Errorf("span for missing go.mod has no error")
+	}
+}
+
+func TestServer_SetLogger(t *testing.T) {
+	m := module.Version{Path: "example.org/awesome", Version: "v1.0.0"}
+	server := proxy.NewServer(&StaticServerOps{
+		GoModData: map[module.Version][]byte{m: []byte("module example.org/awesome\n")},
+	})
+	var buf bytes.Buffer
+	server.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	tracer := &recordingTracer{}
+	server.SetTracer(tracer)
+	testServer := httptest.NewServer(server)
+	defer testServer.Close()
+	httpOps, err := proxy.NewHTTPOps(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := proxy.NewClient(httpOps).Lookup(m.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GoMod(m.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.Stat(m.Version)
+	if !errors.Is(err, proxy.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	records := logRecords(t, &buf)
+	want := []map[string]any{
+		{"level": "DEBUG", "msg": "proxy request start", "method": "GET", "endpoint": "mod"},
+		{"level": "INFO", "msg": "proxy request", "module": m.Path, "version": m.Version, "endpoint": "mod", "status": float64(200), "bytes": float64(len("module example.org/awesome\n"))},
+		{"level": "DEBUG", "msg": "proxy request start", "endpoint": "info"},
+		{"level": "INFO", "msg": "proxy request", "endpoint": "info", "status": float64(404)},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d records, got %d: %v", len(want), len(records), records)
+	}
+	for i, w := range want {
+		for k, v := range w {
+			if records[i][k] != v {
+				t.Errorf("record %d: %s = %v, want %v", i, k, records[i][k], v)
+			}
+		}
+	}
+	if len(tracer.spans) != 2 || tracer.spans[0].err != nil || !errors.Is(tracer.spans[1].err, proxy.ErrNotFound) {
+		t.Errorf("unexpected spans %+v", tracer.spans)
+	}
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+// Cache-Control values of Server responses. The .info, .mod and .zip
+// files of a canonical module version never change, while the list and
+// @latest of a module change whenever a version is published.
+const (
+	immutableCacheControl = "public, max-age=31536000, immutable"
+	mutableCacheControl   = "public, max-age=60"
+)
+
+// versionCacheControl returns the Cache-Control value for a .info, .mod
+// or .zip file of version. Only canonical versions are immutable: the
+// GOPROXY protocol also takes queries such as "master" or a commit hash in
+// their place.
+func versionCacheControl(version string) string {
+	if version != module.CanonicalVersion(version) {
+		return mutableCacheControl
+	}
+	return immutableCacheControl
+}
+
+// A Validator holds the HTTP cache validators of a file served by a
+// Server.
+type Validator struct {
+	// ModTime is the modification time of the file, sent as the
+	// Last-Modified header. The zero time means unknown.
+	ModTime time.Time
+
+	// Hash identifies the content of the file, and is sent as a strong
+	// ETag. It must not contain spaces or double quotes. The empty string
+	// means unknown.
+	Hash string
+}
+
+// ServerOpsValidator is implemented by ServerOps that can tell when the
+// files they serve last changed and what they hold, without reading them.
+// A Server then answers conditional requests without calling the other
+// ServerOps methods, and sends an ETag for .zip files.
+type ServerOpsValidator interface {
+	ServerOps
+	// Validator returns the Validator of the file of m, which is one of
+	// "list", "latest", "info", "mod" and "zip". m.Version is "" for
+	// "list" and "latest". A nil Validator means unknown.
+	Validator(ctx context.Context, m module.Version, file string) (*Validator, error)
+}
+
+// validator returns the Validator of the file of m from the ServerOps, or
+// nil if they do not implement ServerOpsValidator.
+func (s *Server) validator(ctx context.Context, m module.Version, file string) (*Validator, error) {
+	ops, ok := s.ops.(ServerOpsValidator)
+	if !ok {
+		return nil, nil
+	}
+	return ops.Validator(ctx, m, file)
+}
+
+// contentValidator returns v with its Hash, if unknown, computed from
+// data.
+func contentValidator(v *Validator, data []byte) *Validator {
+	if v != nil && v.Hash != "" {
+		return v
+	}
+	sum := sha256.Sum256(data)
+	cv := &Validator{Hash: hex.EncodeToString(sum[:])}
+	if v != nil {
+		cv.ModTime = v.ModTime
+	}
+	return cv
+}
+
+// setCacheHeaders sets the Cache-Control header, and the ETag and
+// Last-Modified headers from v if it is not nil.
+func setCacheHeaders(h http.Header, cacheControl string, v *Validator) {
+	h.Set("Cache-Control", cacheControl)
+	if v == nil {
+		return
+	}
+	if v.Hash != "" {
+		h.Set("ETag", `"`+v.Hash+`"`)
+	}
+	if !v.ModTime.IsZero() {
+		h.Set("Last-Modified", v.ModTime.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified reports whether the If-None-Match or If-Modified-Since
+// header of r shows that the client already has the file with Validator v,
+// and if so responds with 304 Not Modified. As in RFC 9110,
+// If-Modified-Since is ignored when If-None-Match is present.
+func notModified(w http.ResponseWriter, r *http.Request, cacheControl string, v *Validator) bool {
+	if v == nil {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if v.Hash == "" || !etagMatch(inm, v.Hash) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !v.ModTime.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil || v.ModTime.Truncate(time.Second).After(t) {
+			return false
+		}
+	} else {
+		return false
+	}
+	setCacheHeaders(w.Header(), cacheControl, v)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatch reports whether the If-None-Match header value inm matches
+// the ETag of hash, using the weak comparison that RFC 9110 requires.
+func etagMatch(inm, hash string) bool {
+	for _, tag := range strings.Split(inm, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == `"`+hash+`"` {
+			return true
+		}
+	}
+	return false
+}
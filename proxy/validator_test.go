@@ -0,0 +1,181 @@
+package proxy_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jcbhmr/xmod/proxy"
+	"golang.org/x/mod/module"
+)
+
+// validatorServerOps adds validators to a StaticServerOps and counts the
+// calls that read content.
+type validatorServerOps struct {
+	*StaticServerOps
+	modTime time.Time
+	reads   atomic.Int32
+}
+
+func (o *validatorServerOps) Validator(ctx context.Context, m module.Version, file string) (*proxy.Validator, error) {
+	return &proxy.Validator{ModTime: o.modTime, Hash: file + "-" + m.Version}, nil
+}
+
+func (o *validatorServerOps) Versions(ctx context.Context, path string) ([]string, error) {
+	o.reads.Add(1)
+	return o.StaticServerOps.Versions(ctx, path)
+}
+
+func (o *validatorServerOps) Zip(ctx context.Context, dst io.Writer, m module.Version) error {
+	o.reads.Add(1)
+	return o.StaticServerOps.Zip(ctx, dst, m)
+}
+
+func getWithHeader(t *testing.T, u string, header http.Header) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = header
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestServer_CacheHeaders(t *testing.T) {
+	server := httptest.NewServer(proxy.NewServer(routeServerOps()))
+	defer server.Close()
+
+	tests := []struct {
+		path         string
+		cacheControl string
+		etag         bool
+	}{
+		{path: "/example.org/!awesome/@v/list", cacheControl: "public, max-age=60", etag: true},
+		{path: "/example.org/!awesome/@latest", cacheControl: "public, max-age=60", etag: true},
+		{path: "/example.org/!awesome/@v/v1.0.0.info", cacheControl: "public, max-age=31536000, immutable", etag: true},
+		{path: "/example.org/!awesome/@v/v1.0.0.mod", cacheControl: "public, max-age=31536000, immutable", etag: true},
+		// A zip is streamed, so its hash is not known without a Validator.
+		{path: "/example.org/!awesome/@v/v1.0.0.zip", cacheControl: "public, max-age=31536000, immutable"},
+		{path: "/example.org/!awesome/@v/v0.0.1.mod"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp := getWithHeader(t, server.URL+tt.path, nil)
+			if got := resp.Header.Get("Cache-Control"); got != tt.cacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.cacheControl)
+			}
+			etag := resp.Header.Get("ETag")
+			if (etag != "") != tt.etag {
+				t.Fatalf("ETag = %q", etag)
+			}
+			if etag == "" {
+				return
+			}
+			resp = getWithHeader(t, server.URL+tt.path, http.Header{"If-None-Match": {`"stale", W/` + etag}})
+			if resp.StatusCode != http.StatusNotModified {
+				t.Errorf("If-None-Match %s: status %d, want 304", etag, resp.StatusCode)
+			}
+			if resp.Header.Get("ETag") != etag || resp.Header.Get("Cache-Control") != tt.cacheControl {
+				t.Errorf("304 headers = %v", resp.Header)
+			}
+			resp = getWithHeader(t, server.URL+tt.path, http.Header{"If-None-Match": {`"stale"`}})
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("stale If-None-Match: status %d, want 200", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestServer_Validator(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ops := &validatorServerOps{StaticServerOps: routeServerOps(), modTime: modTime}
+	server := httptest.NewServer(proxy.NewServer(ops))
+	defer server.Close()
+
+	zip := server.URL + "/example.org/!awesome/@v/v1.0.0.zip"
+	resp := getWithHeader(t, zip, nil)
+	if got := resp.Header.Get("ETag"); got != `"zip-v1.0.0"` {
+		t.Errorf("ETag = %q", got)
+	}
+	if got := resp.Header.Get("Last-Modified"); got != "Tue, 02 Jan 2024 03:04:05 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+
+	list := server.URL + "/example.org/!awesome/@v/list"
+	tests := []struct {
+		name   string
+		url    string
+		header http.Header
+		status int
+	}{
+		{name: "zip If-None-Match", url: zip, header: http.Header{"If-None-Match": {`"zip-v1.0.0"`}}, status: 304},
+		{name: "list If-Modified-Since", url: list, header: http.Header{"If-Modified-Since": {modTime.Format(http.TimeFormat)}}, status: 304},
+		{name: "list If-Modified-Since later", url: list, header: http.Header{"If-Modified-Since": {modTime.Add(time.Hour).Format(http.TimeFormat)}}, status: 304},
+		{name: "list If-Modified-Since earlier", url: list, header: http.Header{"If-Modified-Since": {modTime.Add(-time.Hour).Format(http.TimeFormat)}}, status: 200},
+		{name: "If-None-Match overrides If-Modified-Since", url: list, header: http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {modTime.Format(http.TimeFormat)}}, status: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops.reads.Store(0)
+			resp := getWithHeader(t, tt.url, tt.header)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+			var wantReads int32
+			if tt.status == http.StatusOK {
+				wantReads = 1
+			}
+			if reads := ops.reads.Load(); reads != wantReads {
+				t.Errorf("%d reads, want %d", reads, wantReads)
+			}
+		})
+	}
+}
+
+// queryServerOps resolves the query "master" to the latest version of a
+// StaticServerOps, as ServerOps backed by a repository or an upstream
+// proxy do.
+type queryServerOps struct {
+	*StaticServerOps
+}
+
+func (o *queryServerOps) Stat(ctx context.Context, m module.Version) (*proxy.RevInfo, error) {
+	if m.Version == "master" {
+		return o.Latest(ctx, m.Path)
+	}
+	return o.StaticServerOps.Stat(ctx, m)
+}
+
+func TestServer_CacheHeadersQuery(t *testing.T) {
+	server := httptest.NewServer(proxy.NewServer(&queryServerOps{routeServerOps()}))
+	defer server.Close()
+
+	tests := []struct {
+		path         string
+		cacheControl string
+	}{
+		{path: "/example.org/!awesome/@v/master.info", cacheControl: "public, max-age=60"},
+		{path: "/example.org/!awesome/@v/v1.0.0.info", cacheControl: "public, max-age=31536000, immutable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp := getWithHeader(t, server.URL+tt.path, nil)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200", resp.StatusCode)
+			}
+			if got := resp.Header.Get("Cache-Control"); got != tt.cacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.cacheControl)
+			}
+		})
+	}
+}
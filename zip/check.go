@@ -232,9 +232,17 @@ func listFilesInDirFS(fsys fs.FS, dir string) (files []modzip.File, omitted []mo
 		if err != nil {
 			return err
 		}
-		relPath, ok := strings.CutPrefix(filePath, dir+"/")
-		if !ok {
-			return fmt.Errorf("%q not relative to %q", filePath, dir)
+		if filePath == dir {
+			// Don't skip the top-level directory.
+			return nil
+		}
+		relPath := filePath
+		if dir != "." {
+			var ok bool
+			relPath, ok = strings.CutPrefix(filePath, dir+"/")
+			if !ok {
+				return fmt.Errorf("%q not relative to %q", filePath, dir)
+			}
 		}
 		slashPath := relPath
 
@@ -248,11 +256,6 @@ func listFilesInDirFS(fsys fs.FS, dir string) (files []modzip.File, omitted []mo
 		}
 
 		if info.IsDir() {
-			if filePath == dir {
-				// Don't skip the top-level directory.
-				return nil
-			}
-
 			// Skip VCS directories.
 			// fossil repos are regular files with arbitrary names, so we don't try
 			// to exclude them.
@@ -278,8 +281,9 @@ func listFilesInDirFS(fsys fs.FS, dir string) (files []modzip.File, omitted []mo
 		}
 
 		files = append(files, dirFileFS{
-			fsys:     fsys,
-			filePath: filePath,
+			fsys:      fsys,
+			filePath:  filePath,
+			slashPath: slashPath,
 		})
 		return nil
 	})
@@ -290,12 +294,12 @@ func listFilesInDirFS(fsys fs.FS, dir string) (files []modzip.File, omitted []mo
 }
 
 type dirFileFS struct {
-	fsys     fs.FS
-	filePath string
+	fsys                fs.FS
+	filePath, slashPath string
 }
 
 func (d dirFileFS) Path() string {
-	return d.filePath
+	return d.slashPath
 }
 func (d dirFileFS) Open() (io.ReadCloser, error) {
 	return d.fsys.Open(d.filePath)
@@ -0,0 +1,155 @@
+package zip
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// Extract extracts the module zip file f for m into the directory dir,
+// the way the go command fills GOMODCACHE: the zip is checked first,
+// with the same rules as golang.org/x/mod/zip.CheckZip, the
+// "path@version/" prefix is stripped, and files and directories are made
+// read-only. The files are written to a temporary directory next to dir,
+// which is renamed to dir once complete, so dir either does not exist or
+// holds the whole module. dir must not already exist.
+func Extract(dir string, m module.Version, f fs.File) (err error) {
+	defer func() {
+		if err != nil {
+			if _, ok := err.(*ZipError); !ok {
+				err = &ZipError{Verb: "unzip", Path: dir, Err: err}
+			}
+		}
+	}()
+
+	z, cf, err := checkZip(m, f)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dir); err == nil {
+		return fmt.Errorf("target directory %v exists", dir)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	parent := filepath.Dir(dir)
+	err = os.MkdirAll(parent, 0o777)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(parent, filepath.Base(dir)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			removeAll(tmp)
+		}
+	}()
+
+	valid := make(map[string]bool, len(cf.Valid))
+	for _, name := range cf.Valid {
+		valid[name] = true
+	}
+	prefix := fmt.Sprintf("%s@%s/", m.Path, m.Version)
+	for _, zf := range z.File {
+		if !valid[zf.Name] {
+			continue
+		}
+		name := filepath.FromSlash(strings.TrimPrefix(zf.Name, prefix))
+		if !filepath.IsLocal(name) {
+			// checkZip rejects such paths, but the file system may
+			// disagree about what a path means.
+			return &ZipError{Verb: "unzip", Path: zf.Name, Err: errPathNotRelative}
+		}
+		dst := filepath.Join(tmp, name)
+		err := os.MkdirAll(filepath.Dir(dst), 0o777)
+		if err != nil {
+			return err
+		}
+		err = extractFile(dst, zf.Open, int64(zf.UncompressedSize64))
+		if err != nil {
+			return &ZipError{Verb: "unzip", Path: zf.Name, Err: err}
+		}
+	}
+
+	err = makeDirsReadOnly(tmp)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// extractFile writes the content of a zip entry of the given size to the
+// new read-only file dst.
+func extractFile(dst string, open func() (io.ReadCloser, error), size int64) (err error) {
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o444)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+	}()
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	lr := &io.LimitedReader{R: r, N: size + 1}
+	_, err = io.Copy(w, lr)
+	if err != nil {
+		return err
+	}
+	if lr.N <= 0 {
+		return fmt.Errorf("uncompressed size of file is larger than declared size (%d bytes)", size)
+	}
+	return nil
+}
+
+// makeDirsReadOnly makes the directories under dir, and dir itself,
+// read-only, as the go command does in the module cache.
+func makeDirsReadOnly(dir string) error {
+	var dirs []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		info, err := os.Lstat(d)
+		if err != nil {
+			return err
+		}
+		err = os.Chmod(d, info.Mode()&^0o222)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeAll removes dir like os.RemoveAll, first making its directories
+// writable again.
+func removeAll(dir string) error {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			os.Chmod(path, 0o777)
+		}
+		return nil
+	})
+	return os.RemoveAll(dir)
+}